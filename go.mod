@@ -6,6 +6,8 @@ require (
 	cloud.google.com/go v0.40.0
 	github.com/codeskyblue/go-sh v0.0.0-20190412065543-76bd3d59ff27
 	github.com/gammazero/workerpool v0.0.0-20190608213748-0ed5e40ec55e
+	github.com/golang/protobuf v1.3.1
+	github.com/googleapis/gax-go/v2 v2.0.4
 	github.com/sanity-io/litter v1.1.0
 	golang.org/x/net v0.0.0-20190613194153-d28f0bde5980
 	google.golang.org/api v0.6.0
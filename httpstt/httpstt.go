@@ -0,0 +1,131 @@
+// Package httpstt describes the OpenAI style /v1/audio/transcriptions
+// API of self-hosted speech recognizers and serves a stand-in for one.
+// transcribe -backend http posts to the API, sttstandin serves the
+// stand-in and transcribe's tests run against it.
+package httpstt
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// Path is where the API takes transcription requests.
+const Path = "/v1/audio/transcriptions"
+
+// Segment is a segment of a verbose JSON transcription.
+type Segment struct {
+	Start      float64 `json:"start"`
+	End        float64 `json:"end"`
+	Text       string  `json:"text"`
+	AvgLogprob float64 `json:"avg_logprob"`
+}
+
+// Word is a word of a verbose JSON transcription.
+type Word struct {
+	Word  string  `json:"word"`
+	Start float64 `json:"start"`
+	End   float64 `json:"end"`
+}
+
+// Transcription is the verbose JSON reply. Times are in seconds from
+// the start of the audio.
+type Transcription struct {
+	Language string    `json:"language"`
+	Duration float64   `json:"duration"`
+	Text     string    `json:"text"`
+	Segments []Segment `json:"segments"`
+	Words    []Word    `json:"words"`
+}
+
+// Canned makes a transcription of one segment saying filename with one
+// word each second.
+func Canned(filename, language string) *Transcription {
+	text := "this is a transcription of " + filename
+	tr := &Transcription{Language: language, Text: text}
+	for i, w := range strings.Fields(text) {
+		tr.Words = append(tr.Words, Word{Word: w, Start: float64(i), End: float64(i) + 0.5})
+	}
+	tr.Duration = float64(len(tr.Words))
+	tr.Segments = []Segment{{Start: 0, End: tr.Duration, Text: " " + text, AvgLogprob: -0.1}}
+	return tr
+}
+
+// Request is a transcription request that the stand-in accepted.
+type Request struct {
+	Filename string
+	Audio    []byte
+	Fields   map[string][]string
+	Auth     string
+}
+
+// Standin is a stand-in recognizer. It checks requests and replies with
+// Reply if it is set or else a Canned transcription. If Code is set, it
+// fails accepted requests with that status instead.
+type Standin struct {
+	Reply []byte
+	Code  int
+
+	mu       sync.Mutex
+	requests []*Request
+}
+
+// Requests returns the requests accepted so far.
+func (s *Standin) Requests() []*Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]*Request(nil), s.requests...)
+}
+
+func (s *Standin) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != Path {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	fd, fh, err := r.FormFile("file")
+	if err != nil {
+		http.Error(w, fmt.Sprintf("no audio file: %v", err), http.StatusBadRequest)
+		return
+	}
+	audio, err := ioutil.ReadAll(fd)
+	fd.Close()
+	if err != nil || len(audio) == 0 {
+		http.Error(w, "empty audio file", http.StatusBadRequest)
+		return
+	}
+	if f := r.FormValue("response_format"); f != "verbose_json" {
+		http.Error(w, fmt.Sprintf("response_format %q is not supported, use verbose_json", f), http.StatusBadRequest)
+		return
+	}
+	log.Printf("transcribing %s, %d bytes, model %q, language %q", fh.Filename, len(audio), r.FormValue("model"), r.FormValue("language"))
+
+	s.mu.Lock()
+	s.requests = append(s.requests, &Request{
+		Filename: fh.Filename,
+		Audio:    audio,
+		Fields:   r.MultipartForm.Value,
+		Auth:     r.Header.Get("Authorization"),
+	})
+	s.mu.Unlock()
+
+	if s.Code != 0 {
+		http.Error(w, fmt.Sprintf("failing with %d", s.Code), s.Code)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if s.Reply != nil {
+		w.Write(s.Reply)
+		return
+	}
+	if err := json.NewEncoder(w).Encode(Canned(fh.Filename, r.FormValue("language"))); err != nil {
+		log.Printf("can't write reply: %v", err)
+	}
+}
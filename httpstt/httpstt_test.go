@@ -0,0 +1,70 @@
+package httpstt
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// post sends audio to s with the given response format.
+func post(s *Standin, audio []byte, format string) *httptest.ResponseRecorder {
+	body := new(bytes.Buffer)
+	mw := multipart.NewWriter(body)
+	fw, _ := mw.CreateFormFile("file", "clip.wav")
+	fw.Write(audio)
+	mw.WriteField("response_format", format)
+	mw.Close()
+
+	r := httptest.NewRequest(http.MethodPost, Path, body)
+	r.Header.Set("Content-Type", mw.FormDataContentType())
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, r)
+	return w
+}
+
+func TestStandin(t *testing.T) {
+	s := new(Standin)
+	w := post(s, []byte("audio"), "verbose_json")
+	if w.Code != http.StatusOK {
+		t.Fatalf("got status %d: %s", w.Code, w.Body)
+	}
+	var tr Transcription
+	if err := json.Unmarshal(w.Body.Bytes(), &tr); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := tr.Text, "this is a transcription of clip.wav"; got != want {
+		t.Errorf("transcribed %q, want %q", got, want)
+	}
+	if got, want := len(tr.Words), 6; got != want {
+		t.Errorf("got %d words, want %d", got, want)
+	}
+
+	for _, format := range []string{"json", "text"} {
+		if w := post(s, []byte("audio"), format); w.Code != http.StatusBadRequest {
+			t.Errorf("format %s: got status %d", format, w.Code)
+		}
+	}
+	if w := post(s, nil, "verbose_json"); w.Code != http.StatusBadRequest {
+		t.Errorf("empty audio: got status %d", w.Code)
+	}
+
+	s.Reply = []byte(`{"text": "canned"}`)
+	if w := post(s, []byte("audio"), "verbose_json"); w.Body.String() != `{"text": "canned"}` {
+		t.Errorf("got reply %s", w.Body)
+	}
+
+	s.Code = http.StatusServiceUnavailable
+	if w := post(s, []byte("audio"), "verbose_json"); w.Code != s.Code {
+		t.Errorf("got status %d, want %d", w.Code, s.Code)
+	}
+	requests := s.Requests()
+	if got, want := len(requests), 3; got != want {
+		t.Fatalf("accepted %d requests, want %d", got, want)
+	}
+	if r := requests[2]; r.Filename != "clip.wav" || string(r.Audio) != "audio" || r.Fields["response_format"][0] != "verbose_json" {
+		t.Errorf("recorded %+v", r)
+	}
+}
@@ -13,12 +13,15 @@ import (
 	"github.com/gammazero/workerpool"
 )
 
-const helptext = `Usage: prepaudio indir outdir
+const helptext = `Usage: prepaudio [-keepchannels] indir outdir
 
 prepaudio reads all of the media files in indir and converts them into
 WAV format audio not exceeding the maximum supported length in outdir.
+The audio is down-mixed to mono unless -keepchannels is given.
 `
 
+var keepchannels = flag.Bool("keepchannels", false, "keep every audio channel instead of down-mixing to mono, e.g. for one mic per person")
+
 // usage prints a usage message for this command.
 func usage(status int) {
 	io.WriteString(os.Stdout, helptext)
@@ -117,8 +120,7 @@ func main() {
 func convertandsplit(fn, outdir, bonexed, destname string, wp *workerpool.WorkerPool, donez chan<- string) {
 	// log.Printf("Starting conversion of %s -> %s\n", fn, destname)
 
-	// Runs ffmpeg -i infile -ac 1 outfile.wav, the -ac 1 forces down-mix to mono.
-	if ffmpegoutput, err := sh.Command("ffmpeg", "-i", fn, "-ac", "1", destname).CombinedOutput(); err != nil {
+	if ffmpegoutput, err := sh.Command("ffmpeg", convertargs(fn, destname, *keepchannels)...).CombinedOutput(); err != nil {
 		log.Printf("command failed %v\nLog for conversion of %s -> %s\n%s", err, fn, destname, string(ffmpegoutput))
 		donez <- ""
 		return
@@ -147,6 +149,17 @@ func convertandsplit(fn, outdir, bonexed, destname string, wp *workerpool.Worker
 	donez <- destname
 }
 
+// convertargs returns the ffmpeg arguments to convert fn to the WAV file
+// destname. Runs ffmpeg -i infile -ac 1 outfile.wav, the -ac 1 forces
+// down-mix to mono unless keepchannels is set.
+func convertargs(fn, destname string, keepchannels bool) []interface{} {
+	args := []interface{}{"-i", fn}
+	if !keepchannels {
+		args = append(args, "-ac", "1")
+	}
+	return append(args, destname)
+}
+
 // makeslicename creates the special filenames for slices of a larger
 // wav. I had used 〖 and 〗for bracketing the slice index. But it doesn't
 // work with GCP.
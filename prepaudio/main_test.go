@@ -0,0 +1,15 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestConvertargs(t *testing.T) {
+	if got, want := convertargs("in.mov", "out.wav", false), []interface{}{"-i", "in.mov", "-ac", "1", "out.wav"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("mono: got %v, want %v", got, want)
+	}
+	if got, want := convertargs("in.mov", "out.wav", true), []interface{}{"-i", "in.mov", "out.wav"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("keepchannels: got %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"strings"
+	"time"
+)
+
+var cuechars = flag.Int("cuechars", 42, "break caption lines longer than this many characters")
+var cuelines = flag.Int("cuelines", 2, "put at most this many lines in each caption")
+var cueduration = flag.Duration("cueduration", 7*time.Second, "show each caption for no longer than this")
+
+// cuepause is the longest silence inside a caption.
+const cuepause = 2 * time.Second
+
+// cue is one caption.
+type cue struct {
+	speaker string
+	turn    bool // The speaker starts talking.
+	start   time.Duration
+	end     time.Duration
+	lines   []string
+}
+
+// cueopts limits the size of each cue.
+type cueopts struct {
+	chars    int
+	lines    int
+	duration time.Duration
+}
+
+// fits returns true if word can be added to c without going over the
+// limits in opts. The first line of a turn leaves room for the speaker's
+// name.
+func (c *cue) fits(w *timedword, opts cueopts) bool {
+	if w.speaker != c.speaker || w.end-c.start > opts.duration || w.start-c.end > cuepause {
+		return false
+	}
+	n := len(c.lines)
+	if c.linelen(n-1)+1+len([]rune(w.word)) <= opts.chars {
+		return true
+	}
+	return n < opts.lines
+}
+
+// linelen returns the length of line i including any speaker name.
+func (c *cue) linelen(i int) int {
+	l := len([]rune(c.lines[i]))
+	if i == 0 && c.turn && c.speaker != "" {
+		l += len([]rune(c.speaker)) + 2
+	}
+	return l
+}
+
+// add appends w to c, starting a new line if it doesn't fit on the last.
+func (c *cue) add(w *timedword, opts cueopts) {
+	n := len(c.lines)
+	if c.linelen(n-1)+1+len([]rune(w.word)) <= opts.chars {
+		c.lines[n-1] += " " + w.word
+	} else {
+		c.lines = append(c.lines, w.word)
+	}
+	c.end = w.end
+}
+
+// makecues breaks words into captions. A caption never spans two
+// speakers or a long pause.
+func makecues(words []*timedword, opts cueopts) []*cue {
+	var cues []*cue
+	var c *cue
+	for _, w := range words {
+		if c != nil && c.fits(w, opts) {
+			c.add(w, opts)
+			continue
+		}
+		c = &cue{
+			speaker: w.speaker,
+			turn:    len(cues) == 0 || cues[len(cues)-1].speaker != w.speaker,
+			start:   w.start,
+			end:     w.end,
+			lines:   []string{w.word},
+		}
+		cues = append(cues, c)
+	}
+	return cues
+}
+
+// cues makes the captions of tr with the -cuechars, -cuelines and
+// -cueduration limits.
+func (tr *transcript) cues() []*cue {
+	opts := cueopts{chars: *cuechars, lines: *cuelines, duration: *cueduration}
+	return makecues(tr.words(), opts)
+}
+
+// cuetime formats d as hh:mm:ss followed by sep and the milliseconds.
+func cuetime(d time.Duration, sep string) string {
+	ms := int64(d / time.Millisecond)
+	return fmt.Sprintf("%02d:%02d:%02d%s%03d", ms/3600000, ms/60000%60, ms/1000%60, sep, ms%1000)
+}
+
+// writesrt writes cues as SubRip subtitles. The speaker's name starts
+// each turn.
+func writesrt(cues []*cue, ofd *bufio.Writer) error {
+	for i, c := range cues {
+		lines := append([]string(nil), c.lines...)
+		if c.turn && c.speaker != "" {
+			lines[0] = c.speaker + ": " + lines[0]
+		}
+		if _, err := fmt.Fprintf(ofd, "%d\n%s --> %s\n%s\n\n", i+1, cuetime(c.start, ","), cuetime(c.end, ","), strings.Join(lines, "\n")); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// vttescaper escapes the characters that are special in WebVTT cue text.
+var vttescaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+
+// writevtt writes cues as WebVTT captions with the speakers in voice
+// tags.
+func writevtt(cues []*cue, ofd *bufio.Writer) error {
+	if _, err := ofd.WriteString("WEBVTT\n\n"); err != nil {
+		return err
+	}
+	for _, c := range cues {
+		text := vttescaper.Replace(strings.Join(c.lines, "\n"))
+		if c.speaker != "" {
+			text = fmt.Sprintf("<v %s>%s", vttescaper.Replace(c.speaker), text)
+		}
+		if _, err := fmt.Fprintf(ofd, "%s --> %s\n%s\n\n", cuetime(c.start, "."), cuetime(c.end, "."), text); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"testing"
+	"time"
+
+	speechpb "google.golang.org/genproto/googleapis/cloud/speech/v1p1beta1"
+)
+
+func TestMakecues(t *testing.T) {
+	words := []*timedword{
+		{word: "hello", speaker: "SPEAKER_1", start: 0, end: time.Second},
+		{word: "there", speaker: "SPEAKER_1", start: time.Second, end: 2 * time.Second},
+		{word: "how", speaker: "SPEAKER_1", start: 2 * time.Second, end: 3 * time.Second},
+		{word: "are", speaker: "SPEAKER_1", start: 3 * time.Second, end: 4 * time.Second},
+		{word: "you", speaker: "SPEAKER_1", start: 4 * time.Second, end: 5 * time.Second},
+		{word: "fine", speaker: "SPEAKER_2", start: 5 * time.Second, end: 6 * time.Second},
+		{word: "thanks", speaker: "SPEAKER_2", start: 10 * time.Second, end: 11 * time.Second},
+	}
+	cues := makecues(words, cueopts{chars: 20, lines: 2, duration: 4 * time.Second})
+
+	want := []struct {
+		lines []string
+		turn  bool
+		start time.Duration
+		end   time.Duration
+	}{
+		// SPEAKER_1: takes 11 characters of the first line.
+		{[]string{"hello", "there how are"}, true, 0, 4 * time.Second},
+		{[]string{"you"}, false, 4 * time.Second, 5 * time.Second},
+		{[]string{"fine"}, true, 5 * time.Second, 6 * time.Second},
+		// After a long pause.
+		{[]string{"thanks"}, false, 10 * time.Second, 11 * time.Second},
+	}
+	if len(cues) != len(want) {
+		t.Fatalf("got %d cues, want %d", len(cues), len(want))
+	}
+	for i, w := range want {
+		c := cues[i]
+		if len(c.lines) != len(w.lines) || c.turn != w.turn || c.start != w.start || c.end != w.end {
+			t.Errorf("cue %d is %v, want %v", i, c, w)
+			continue
+		}
+		for k := range w.lines {
+			if c.lines[k] != w.lines[k] {
+				t.Errorf("cue %d line %d is %q, want %q", i, k, c.lines[k], w.lines[k])
+			}
+		}
+	}
+}
+
+func TestWritecaptions(t *testing.T) {
+	resp := &speechpb.LongRunningRecognizeResponse{
+		Results: []*speechpb.SpeechRecognitionResult{
+			{Alternatives: []*speechpb.SpeechRecognitionAlternative{{Transcript: "hi <there>"}}},
+			{
+				Alternatives: []*speechpb.SpeechRecognitionAlternative{{
+					Words: []*speechpb.WordInfo{word("hi", 0, 1), word("<there>", 1, 2), word("bye", 2, 3)},
+				}},
+			},
+		},
+	}
+	resp.Results[1].Alternatives[0].Words[0].SpeakerTag = 1
+	resp.Results[1].Alternatives[0].Words[1].SpeakerTag = 1
+	resp.Results[1].Alternatives[0].Words[2].SpeakerTag = 2
+	tr := &transcript{
+		filename: "clip-<1>.json",
+		resp:     resp,
+		offset:   gettimeoffset("clip-<1>.json"),
+		names:    speakernames{"SPEAKER_2": "Kenobi"},
+	}
+	cues := tr.cues()
+
+	buffy := new(bytes.Buffer)
+	w := bufio.NewWriter(buffy)
+	if err := writesrt(cues, w); err != nil {
+		t.Fatal(err)
+	}
+	w.Flush()
+	if got, want := buffy.String(), "1\n00:45:00,000 --> 00:45:02,000\nSPEAKER_1: hi <there>\n\n2\n00:45:02,000 --> 00:45:03,000\nKenobi: bye\n\n"; got != want {
+		t.Errorf("srt is %q, want %q", got, want)
+	}
+
+	buffy.Reset()
+	if err := writevtt(cues, w); err != nil {
+		t.Fatal(err)
+	}
+	w.Flush()
+	if got, want := buffy.String(), "WEBVTT\n\n00:45:00.000 --> 00:45:02.000\n<v SPEAKER_1>hi &lt;there&gt;\n\n00:45:02.000 --> 00:45:03.000\n<v Kenobi>bye\n\n"; got != want {
+		t.Errorf("vtt is %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/golang/protobuf/ptypes/duration"
+	speechpb "google.golang.org/genproto/googleapis/cloud/speech/v1p1beta1"
+)
+
+// word makes a WordInfo for w spoken from start to end seconds.
+func word(w string, start, end int64) *speechpb.WordInfo {
+	return &speechpb.WordInfo{
+		Word:      w,
+		StartTime: &duration.Duration{Seconds: start},
+		EndTime:   &duration.Duration{Seconds: end},
+	}
+}
+
+func TestAggregateChannels(t *testing.T) {
+	resp := &speechpb.LongRunningRecognizeResponse{
+		Results: []*speechpb.SpeechRecognitionResult{
+			{
+				ChannelTag: 1,
+				Alternatives: []*speechpb.SpeechRecognitionAlternative{
+					{Transcript: "hi there", Words: []*speechpb.WordInfo{word("hi", 0, 1), word("there", 1, 2)}},
+				},
+			},
+			{
+				ChannelTag: 2,
+				Alternatives: []*speechpb.SpeechRecognitionAlternative{
+					{Transcript: "hello", Words: []*speechpb.WordInfo{word("hello", 3, 4)}},
+				},
+			},
+			{
+				ChannelTag: 1,
+				Alternatives: []*speechpb.SpeechRecognitionAlternative{
+					{Transcript: "bye", Words: []*speechpb.WordInfo{word("bye", 6, 7)}},
+				},
+			},
+		},
+	}
+
+	speakers := aggregateChannels(resp)
+	if got, want := len(speakers), 2; got != want {
+		t.Fatalf("got %d channels, want %d", got, want)
+	}
+	buffy := new(bytes.Buffer)
+	ofd := bufio.NewWriter(buffy)
+	if err := printWords(speakers, ofd, 0); err != nil {
+		t.Fatal(err)
+	}
+	ofd.Flush()
+	want := "0s: CHANNEL_1\nhi there \n\n3s: CHANNEL_2\nhello \n\n6s: CHANNEL_1\nbye "
+	if got := buffy.String(); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	// Mono audio may still have its results tagged with channel 1.
+	resp.Results[1].ChannelTag = 1
+	if speakers := aggregateChannels(resp); speakers != nil {
+		t.Errorf("got channels %v from one channel", speakers)
+	}
+}
+
+func TestChannelsWithoutWordTimes(t *testing.T) {
+	// separate_channels with word_confidence but no word_time_offsets.
+	resp := &speechpb.LongRunningRecognizeResponse{
+		Results: []*speechpb.SpeechRecognitionResult{
+			{
+				ChannelTag: 1,
+				Alternatives: []*speechpb.SpeechRecognitionAlternative{
+					{Transcript: "hi there", Words: []*speechpb.WordInfo{{Word: "hi", Confidence: 0.9}, {Word: "there", Confidence: 0.8}}},
+				},
+			},
+			{
+				ChannelTag: 2,
+				Alternatives: []*speechpb.SpeechRecognitionAlternative{
+					{Transcript: "hello", Words: []*speechpb.WordInfo{{Word: "hello", Confidence: 0.7}}},
+				},
+			},
+		},
+	}
+
+	got := writetxtstring(t, &transcript{filename: "testdata/none.json", resp: resp})
+	for _, want := range []string{"CHANNEL_1\nhi there", "CHANNEL_2\nhello"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("got %q, want it to contain %q", got, want)
+		}
+	}
+	if words := timedwords(resp, 0); len(words) != 0 {
+		t.Errorf("got %d timed words from words without times", len(words))
+	}
+}
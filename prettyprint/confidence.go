@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/golang/protobuf/ptypes"
+	speechpb "google.golang.org/genproto/googleapis/cloud/speech/v1p1beta1"
+)
+
+var lowconfidence = flag.Float64("lowconf", 0, "mark words recognized with less than this confidence, e.g. 0.6")
+var listalternatives = flag.Bool("alternatives", false, "list the other hypotheses of segments recognized with less than -lowconf confidence")
+
+// islowconfidence returns true if confidence is below -lowconf. The API
+// leaves the confidence at 0 when it wasn't asked for it.
+func islowconfidence(confidence float32) bool {
+	return confidence > 0 && float64(confidence) < *lowconfidence
+}
+
+// markword returns the word in wi, in brackets if it has low confidence.
+func markword(wi *speechpb.WordInfo) string {
+	if islowconfidence(wi.Confidence) {
+		return "[" + wi.Word + "]"
+	}
+	return wi.Word
+}
+
+// markedtranscript returns the transcript of alt with the low confidence
+// words marked.
+func markedtranscript(alt *speechpb.SpeechRecognitionAlternative) string {
+	if *lowconfidence <= 0 || len(alt.Words) == 0 {
+		return alt.Transcript
+	}
+	words := make([]string, 0, len(alt.Words))
+	for _, wi := range alt.Words {
+		words = append(words, markword(wi))
+	}
+	return strings.Join(words, " ")
+}
+
+// isuncertain returns true if the top hypothesis of r or any of its
+// words has low confidence.
+func isuncertain(r *speechpb.SpeechRecognitionResult) bool {
+	if len(r.Alternatives) == 0 {
+		return false
+	}
+	alt := r.Alternatives[0]
+	if islowconfidence(alt.Confidence) {
+		return true
+	}
+	for _, wi := range alt.Words {
+		if islowconfidence(wi.Confidence) {
+			return true
+		}
+	}
+	return false
+}
+
+// printAlternatives lists every hypothesis of the uncertain segments in
+// resp that have more than one.
+func printAlternatives(resp *speechpb.LongRunningRecognizeResponse, ofd *bufio.Writer, offset time.Duration) error {
+	header := false
+	for _, r := range resp.Results {
+		// The result holding all of the words when the speakers were
+		// recognized has no transcript.
+		if len(r.Alternatives) < 2 || r.Alternatives[0].Transcript == "" || !isuncertain(r) {
+			continue
+		}
+		if !header {
+			if _, err := fmt.Fprintf(ofd, "\n\nUncertain segments:\n"); err != nil {
+				return err
+			}
+			header = true
+		}
+
+		start := offset
+		if words := r.Alternatives[0].Words; len(words) > 0 {
+			if d, err := ptypes.Duration(words[0].StartTime); err == nil {
+				start += d
+			}
+		}
+		if _, err := fmt.Fprintf(ofd, "\n%s:\n", start); err != nil {
+			return err
+		}
+		for _, alt := range r.Alternatives {
+			if _, err := fmt.Fprintf(ofd, "    %s (%.2f)\n", strings.TrimSpace(alt.Transcript), alt.Confidence); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"testing"
+
+	"github.com/golang/protobuf/ptypes/duration"
+	speechpb "google.golang.org/genproto/googleapis/cloud/speech/v1p1beta1"
+)
+
+func TestConfidence(t *testing.T) {
+	oldlow := *lowconfidence
+	*lowconfidence = 0.6
+	defer func() { *lowconfidence = oldlow }()
+
+	resp := &speechpb.LongRunningRecognizeResponse{
+		Results: []*speechpb.SpeechRecognitionResult{
+			{
+				Alternatives: []*speechpb.SpeechRecognitionAlternative{
+					{
+						Transcript: "hello there",
+						Confidence: 0.8,
+						Words: []*speechpb.WordInfo{
+							{Word: "hello", Confidence: 0.9, StartTime: &duration.Duration{Seconds: 3}},
+							{Word: "there", Confidence: 0.4},
+						},
+					},
+					{Transcript: "hello their", Confidence: 0.3},
+				},
+			},
+			{
+				Alternatives: []*speechpb.SpeechRecognitionAlternative{
+					{Transcript: "sure", Confidence: 0.95},
+					{Transcript: "shore", Confidence: 0.2},
+				},
+			},
+		},
+	}
+
+	if got, want := markedtranscript(resp.Results[0].Alternatives[0]), "hello [there]"; got != want {
+		t.Errorf("marked transcript %q, want %q", got, want)
+	}
+	if got, want := markedtranscript(resp.Results[1].Alternatives[0]), "sure"; got != want {
+		t.Errorf("marked transcript %q, want %q", got, want)
+	}
+
+	buffy := new(bytes.Buffer)
+	ofd := bufio.NewWriter(buffy)
+	if err := printAlternatives(resp, ofd, 0); err != nil {
+		t.Fatal(err)
+	}
+	ofd.Flush()
+	want := "\n\nUncertain segments:\n\n3s:\n    hello there (0.80)\n    hello their (0.30)\n"
+	if got := buffy.String(); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	// Without word confidence, nothing is marked.
+	*lowconfidence = 0
+	if got, want := markedtranscript(resp.Results[0].Alternatives[0]), "hello there"; got != want {
+		t.Errorf("unmarked transcript %q, want %q", got, want)
+	}
+}
+
+func TestWriteTxtWordConfidence(t *testing.T) {
+	oldlow := *lowconfidence
+	*lowconfidence = 0.6
+	defer func() { *lowconfidence = oldlow }()
+
+	// -wordconfidence without diarization gives words with confidences
+	// but no speakers.
+	words := []*speechpb.WordInfo{word("hello", 0, 1), word("there", 1, 2)}
+	words[0].Confidence, words[1].Confidence = 0.9, 0.4
+	resp := &speechpb.LongRunningRecognizeResponse{
+		Results: []*speechpb.SpeechRecognitionResult{
+			{Alternatives: []*speechpb.SpeechRecognitionAlternative{{Transcript: "hello there", Words: words}}},
+		},
+	}
+
+	if got, want := writetxtstring(t, &transcript{filename: "testdata/none.json", resp: resp}), "hello [there] \n\n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
@@ -2,7 +2,6 @@ package main
 
 import (
 	"bufio"
-	"encoding/json"
 	"flag"
 	"fmt"
 	"io"
@@ -10,20 +9,46 @@ import (
 	"math"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 	"time"
 
+	"github.com/rjkroege/transcription/resultname"
 	speechpb "google.golang.org/genproto/googleapis/cloud/speech/v1p1beta1"
 )
 
 // TODO(rjk): Update
 const usage = `prettyprint`
 
+var stitch = flag.Bool("stitch", false, "join the slices of each recording into one transcript")
+var outputformats = flag.String("format", "txt", "comma separated list of outputs to write: txt, srt, vtt, html or md")
+
 func main() {
 	flag.Parse()
 
-	// TODO(rjk): Be able to process multiple files at once.
+	// Provenance sidecars and speaker names are read along with their
+	// transcriptions.
+	var filenames []string
 	for _, fn := range flag.Args() {
+		if strings.HasSuffix(fn, resultname.MetaSuffix) || strings.HasSuffix(fn, speakersuffix) || filepath.Base(fn) == speakersname {
+			continue
+		}
+		filenames = append(filenames, fn)
+	}
+
+	if *stitch {
+		recordings, whole := groupslices(filenames)
+		bases := make([]string, 0, len(recordings))
+		for base := range recordings {
+			bases = append(bases, base)
+		}
+		sort.Strings(bases)
+		for _, base := range bases {
+			dostitch(base, recordings[base])
+		}
+		filenames = whole
+	}
+	for _, fn := range filenames {
 		doprettyprint(fn)
 	}
 }
@@ -39,43 +64,154 @@ func dumpwordbundles(speakers [][]*wordBundle) {
 	}
 }
 
+// transcript is a transcription and what's needed to write it out.
+type transcript struct {
+	filename string
+	resp     *speechpb.LongRunningRecognizeResponse
+	offset   time.Duration // Where the slice starts in the recording.
+	names    speakernames
+}
+
+// words returns the words of tr labelled with the names of their
+// speakers.
+func (tr *transcript) words() []*timedword {
+	words := timedwords(tr.resp, tr.offset)
+	tr.names.rename(words)
+	return words
+}
+
+// formats are the kinds of output that prettyprint can write, keyed by
+// their file extension.
+var formats = map[string]func(tr *transcript, ofd *bufio.Writer) error{
+	"txt": writetxt,
+	"srt": func(tr *transcript, ofd *bufio.Writer) error {
+		return writesrt(tr.cues(), ofd)
+	},
+	"vtt": func(tr *transcript, ofd *bufio.Writer) error {
+		return writevtt(tr.cues(), ofd)
+	},
+	"html": writehtml,
+	"md":   writemarkdown,
+}
+
 // doprettyprint will convert a single JSON transcription filename into
-// something that approximates the formatting of a screenplay.
+// each of the -format outputs.
 func doprettyprint(filename string) error {
-	fd, err := os.Open(filename)
+	resp, err := readresponse(filename)
 	if err != nil {
-		log.Println("can't open input file", filename, "because", err)
+		log.Printf("%s: can't decode transcription JSON file because %v\n", filename, err)
 		return err
 	}
-	defer fd.Close()
-	slurper := json.NewDecoder(fd)
+	names, err := readspeakernames(filename)
+	if err != nil {
+		log.Printf("%s: can't read speaker names because %v\n", filename, err)
+		return err
+	}
+	return writetranscript(&transcript{
+		filename: filename,
+		resp:     resp,
+		offset:   gettimeoffset(filename),
+		names:    names,
+	})
+}
 
-	var resp speechpb.LongRunningRecognizeResponse
-	if err := slurper.Decode(&resp); err != nil {
-		log.Printf("%s: can't decode transcription JSON file because %v\n", filename, err)
+// dostitch joins the transcriptions of the slices of the recording
+// base, ordered by slice, into one transcription and writes it out in
+// each of the -format outputs. Every slice needs word times to be
+// placed on the timeline so nothing is written if one doesn't have them.
+func dostitch(base string, filenames []string) error {
+	slices := make([][]*timedword, 0, len(filenames))
+	offsets := make([]time.Duration, 0, len(filenames))
+	for _, fn := range filenames {
+		resp, err := readresponse(fn)
+		if err != nil {
+			log.Printf("%s: can't decode transcription JSON file because %v\n", fn, err)
+			return err
+		}
+		offset := gettimeoffset(fn)
+		words := timedwords(resp, offset)
+		if len(words) == 0 {
+			log.Printf("%s: has no word times so %s can't be stitched\n", fn, base)
+			return fmt.Errorf("%s: no word times", fn)
+		}
+		slices = append(slices, words)
+		offsets = append(offsets, offset)
+	}
+	log.Printf("stitching %d slices into %s\n", len(filenames), base)
+
+	names, err := readspeakernames(base)
+	if err != nil {
+		log.Printf("%s: can't read speaker names because %v\n", base, err)
 		return err
 	}
+	return writetranscript(&transcript{
+		filename: base,
+		resp:     stitchedresponse(stitchslices(slices, offsets)),
+		names:    names,
+	})
+}
+
+// writetranscript writes tr in each of the -format outputs.
+func writetranscript(tr *transcript) error {
+	filename := tr.filename
+	words := timedwords(tr.resp, tr.offset)
+	if err := reportunnamed(os.Stdout, filename, words, tr.names); err != nil {
+		log.Printf("%s: can't report unnamed speakers: %v\n", filename, err)
+	}
 
+	for _, format := range strings.Split(*outputformats, ",") {
+		format = strings.TrimSpace(format)
+		writer, ok := formats[format]
+		if !ok {
+			log.Printf("unknown format %q\n", format)
+			continue
+		}
+		// Every format but txt places the words on the timeline.
+		if format != "txt" && len(words) == 0 {
+			log.Printf("%s: has no word times, not writing %s\n", filename, format)
+			continue
+		}
+
+		ofn := resultname.Trim(filepath.Base(filename)) + "." + format
+		ofd, err := os.Create(ofn)
+		if err != nil {
+			log.Fatalln("can't open ouput filename", ofn, "because", err)
+		}
+		bofd := bufio.NewWriter(ofd)
+		if err := writer(tr, bofd); err != nil {
+			log.Printf("File %s failed writing %s: %v\n", filename, ofn, err)
+		}
+		if err := bofd.Flush(); err != nil {
+			log.Printf("File %s failed to flush: %v\n", filename, err)
+		}
+		ofd.Close()
+	}
+	return nil
+}
+
+// writetxt writes tr in a format that approximates a screenplay.
+func writetxt(tr *transcript, bofd *bufio.Writer) error {
+	filename, resp, offset := tr.filename, tr.resp, tr.offset
 	var speakers SpeakersType
-	if len(resp.Results) < 1 || resp.Results[len(resp.Results)-1].Alternatives == nil {
+	if channels := aggregateChannels(resp); channels != nil {
+		speakers = channels
+	} else if len(resp.Results) < 1 || resp.Results[len(resp.Results)-1].Alternatives == nil {
 		log.Printf("last Result in input JSON %s is empty assuming no speaker separation", filename)
-	} else {
-		speakers = aggregateWords(&resp)
+	} else if diarized(resp) {
+		speakers = aggregateWords(resp)
 	}
+	tr.names.renamebundles(speakers)
 
-	bp := filepath.Base(filename)
-	ofn := strings.TrimSuffix(bp, filepath.Ext(bp)) + ".txt"
-	ofd, err := os.Create(ofn)
-	if err != nil {
-		log.Fatalln("can't open ouput filename", ofn, "because", err)
+	if prov, err := readprovenance(resultname.Meta(filename)); err != nil {
+		log.Printf("File %s has unreadable provenance: %v\n", filename, err)
+	} else if prov != nil {
+		if err := printHeader(prov, bofd); err != nil {
+			log.Printf("File %s failed in printHeader: %v\n", filename, err)
+		}
 	}
-	defer ofd.Close()
-	bofd := bufio.NewWriter(ofd)
-
-	offset := gettimeoffset(filename)
 
 	if speakers == nil {
-		if err := printTranscript(&resp, bofd); err != nil {
+		if err := printTranscript(resp, tr.names, bofd); err != nil {
 			log.Printf("File %s failed in printTranscript: %v\n", filename, err)
 		}
 	} else {
@@ -83,8 +219,10 @@ func doprettyprint(filename string) error {
 			log.Printf("File %s failed in printWords: %v\n", filename, err)
 		}
 	}
-	if err := bofd.Flush(); err != nil {
-		log.Printf("File %s failed to flush: %v\n", filename, err)
+	if *listalternatives && *lowconfidence > 0 {
+		if err := printAlternatives(resp, bofd, offset); err != nil {
+			log.Printf("File %s failed in printAlternatives: %v\n", filename, err)
+		}
 	}
 	return nil
 }
@@ -117,8 +255,8 @@ func printLinebrokenString(ofd *bufio.Writer, s string) error {
 }
 
 // printTranscript prints the transcription contents if no per-speaker
-// content was available.
-func printTranscript(resp *speechpb.LongRunningRecognizeResponse, ofd *bufio.Writer) error {
+// content was available. Channels are labelled with their names.
+func printTranscript(resp *speechpb.LongRunningRecognizeResponse, names speakernames, ofd *bufio.Writer) error {
 	log.Println("running printTranscript")
 	for _, r := range resp.Results {
 		// Maybe the Result is empty? Skip it.
@@ -126,7 +264,12 @@ func printTranscript(resp *speechpb.LongRunningRecognizeResponse, ofd *bufio.Wri
 			continue
 		}
 
-		if err := printLinebrokenString(ofd, r.Alternatives[0].Transcript); err != nil {
+		if r.ChannelTag > 0 {
+			if _, err := fmt.Fprintf(ofd, "%s: ", names.name(fmt.Sprintf("CHANNEL_%d", r.ChannelTag))); err != nil {
+				return err
+			}
+		}
+		if err := printLinebrokenString(ofd, markedtranscript(r.Alternatives[0])); err != nil {
 			return err
 		}
 
@@ -150,10 +293,10 @@ type wordBundle struct {
 
 func makeWordBundle(wi *speechpb.WordInfo) *wordBundle {
 	return &wordBundle{
-		utterance: wi.Word,
+		utterance: markword(wi),
 		speaker:   fmt.Sprintf("SPEAKER_%d", wi.SpeakerTag),
-		start:     time.Duration(int64(wi.StartTime.Nanos) + int64(time.Second)*int64(wi.StartTime.Seconds)),
-		end:       time.Duration(int64(wi.EndTime.Nanos) + int64(time.Second)*int64(wi.EndTime.Seconds)),
+		start:     wordtime(wi.StartTime),
+		end:       wordtime(wi.EndTime),
 	}
 }
 
@@ -195,31 +338,45 @@ func aggregateWords(resp *speechpb.LongRunningRecognizeResponse) SpeakersType {
 
 	speakers := make(SpeakersType)
 	for _, wi := range lastWords {
-		speaker, ok := speakers[int(wi.SpeakerTag)]
-		if !ok {
-			speaker = make([]*wordBundle, 0, 10)
-			speakers[int(wi.SpeakerTag)] = speaker
-		}
-		wb := makeWordBundle(wi)
+		speakers.add(int(wi.SpeakerTag), makeWordBundle(wi))
+	}
 
-		if len(speaker) == 0 {
-			speaker = append(speaker, wb)
-			speakers[int(wi.SpeakerTag)] = speaker
+	return speakers
+}
+
+// aggregateChannels builds a per-channel word bundle if each channel of
+// resp was recognized separately. The channels are labelled like
+// speakers. Returns nil unless resp has words from more than one
+// channel.
+func aggregateChannels(resp *speechpb.LongRunningRecognizeResponse) SpeakersType {
+	speakers := make(SpeakersType)
+	for _, r := range resp.Results {
+		if r.ChannelTag == 0 || len(r.Alternatives) == 0 {
 			continue
 		}
-
-		lastwb := speaker[len(speaker)-1]
-		if lastwb.shouldMerge(wb) {
-			lastwb.mergeUtterance(wb)
-		} else {
-			speaker = append(speaker, wb)
-			speakers[int(wi.SpeakerTag)] = speaker
+		for _, wi := range r.Alternatives[0].Words {
+			wb := makeWordBundle(wi)
+			wb.speaker = fmt.Sprintf("CHANNEL_%d", r.ChannelTag)
+			speakers.add(int(r.ChannelTag), wb)
 		}
 	}
-
+	if len(speakers) < 2 {
+		return nil
+	}
 	return speakers
 }
 
+// add appends wb to the utterances of speaker, merging it into the last
+// one if there's no pause between them.
+func (speakers SpeakersType) add(speaker int, wb *wordBundle) {
+	utterances := speakers[speaker]
+	if n := len(utterances); n > 0 && utterances[n-1].shouldMerge(wb) {
+		utterances[n-1].mergeUtterance(wb)
+		return
+	}
+	speakers[speaker] = append(utterances, wb)
+}
+
 func findEarliestSpeaker(speakers SpeakersType) int {
 	t := int64(math.MaxInt64)
 	sp := 0
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	speechpb "google.golang.org/genproto/googleapis/cloud/speech/v1p1beta1"
+)
+
+// writetxtstring returns what writetxt writes for tr.
+func writetxtstring(t *testing.T, tr *transcript) string {
+	t.Helper()
+	buffy := new(bytes.Buffer)
+	ofd := bufio.NewWriter(buffy)
+	if err := writetxt(tr, ofd); err != nil {
+		t.Fatal(err)
+	}
+	ofd.Flush()
+	return buffy.String()
+}
+
+func TestWriteTxtSegments(t *testing.T) {
+	// The http backend makes one result per segment with words that
+	// have no speakers.
+	resp := &speechpb.LongRunningRecognizeResponse{
+		Results: []*speechpb.SpeechRecognitionResult{
+			{
+				Alternatives: []*speechpb.SpeechRecognitionAlternative{
+					{Transcript: "Hello there.", Confidence: 0.9, Words: []*speechpb.WordInfo{word("Hello", 0, 1), word("there.", 1, 2)}},
+				},
+				LanguageCode: "en-US",
+			},
+			{
+				Alternatives: []*speechpb.SpeechRecognitionAlternative{
+					{Transcript: "Bye now.", Confidence: 0.8, Words: []*speechpb.WordInfo{word("Bye", 4, 5), word("now.", 5, 6)}},
+				},
+				LanguageCode: "en-US",
+			},
+		},
+	}
+
+	got := writetxtstring(t, &transcript{filename: "testdata/none-en-US.json", resp: resp})
+	for _, want := range []string{"Hello there.", "Bye now."} {
+		if !strings.Contains(got, want) {
+			t.Errorf("got %q, want it to contain %q", got, want)
+		}
+	}
+}
+
+func TestWriteTranscriptNoWordTimes(t *testing.T) {
+	dir, err := ioutil.TempDir("", "prettyprint")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+	defer func(old string) { *outputformats = old }(*outputformats)
+	*outputformats = "txt,srt,vtt,html,md"
+
+	// The default profile has no word times.
+	resp := &speechpb.LongRunningRecognizeResponse{
+		Results: []*speechpb.SpeechRecognitionResult{
+			{Alternatives: []*speechpb.SpeechRecognitionAlternative{{Transcript: "hello there"}}},
+		},
+	}
+	if err := writetranscript(&transcript{filename: "clip-en-US.json", resp: resp}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat("clip-en-US.txt"); err != nil {
+		t.Errorf("didn't write the text: %v", err)
+	}
+	for _, format := range []string{"srt", "vtt", "html", "md"} {
+		if _, err := os.Stat("clip-en-US." + format); !os.IsNotExist(err) {
+			t.Errorf("wrote %s without word times: %v", format, err)
+		}
+	}
+}
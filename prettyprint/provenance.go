@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	speechpb "google.golang.org/genproto/googleapis/cloud/speech/v1p1beta1"
+)
+
+// provenance is the part of a transcribe provenance sidecar that goes in
+// the header of the output.
+type provenance struct {
+	Source   string `json:"source"`
+	Local    string `json:"local"`
+	MD5      string `json:"md5"`
+	Speakers int    `json:"speakers"`
+	Profile  *struct {
+		Name string `json:"name"`
+	} `json:"profile"`
+	Config    *speechpb.RecognitionConfig `json:"config"`
+	Method    string                      `json:"method"`
+	Backend   string                      `json:"backend"`
+	Operation string                      `json:"operation"`
+	Submitted time.Time                   `json:"submitted"`
+	Finished  time.Time                   `json:"finished"`
+	Version   string                      `json:"version"`
+}
+
+// readprovenance reads the provenance sidecar fn. Returns nil if there
+// isn't one.
+func readprovenance(fn string) (*provenance, error) {
+	fd, err := os.Open(fn)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer fd.Close()
+
+	var prov provenance
+	if err := json.NewDecoder(fd).Decode(&prov); err != nil {
+		return nil, fmt.Errorf("%s: %v", fn, err)
+	}
+	return &prov, nil
+}
+
+// printHeader prints how the transcription was made.
+func printHeader(prov *provenance, ofd *bufio.Writer) error {
+	source := prov.Source
+	if prov.MD5 != "" {
+		source += " (md5 " + prov.MD5 + ")"
+	}
+	fmt.Fprintf(ofd, "Source: %s\n", source)
+	if prov.Local != "" {
+		fmt.Fprintf(ofd, "Local file: %s\n", prov.Local)
+	}
+	if c := prov.Config; c != nil {
+		languages := c.LanguageCode
+		if len(c.AlternativeLanguageCodes) > 0 {
+			languages += " (also " + strings.Join(c.AlternativeLanguageCodes, ", ") + ")"
+		}
+		fmt.Fprintf(ofd, "Language: %s\n", languages)
+
+		model := c.Model
+		if model == "" {
+			model = "default"
+		}
+		if c.UseEnhanced {
+			model += ", enhanced"
+		}
+		if prov.Profile != nil {
+			model += " (profile " + prov.Profile.Name + ")"
+		}
+		fmt.Fprintf(ofd, "Model: %s\n", model)
+	}
+	fmt.Fprintf(ofd, "Speakers: %d\n", prov.Speakers)
+	method := prov.Method
+	if prov.Operation != "" {
+		method += " " + prov.Operation
+	}
+	if prov.Backend != "" {
+		method += " with " + prov.Backend
+	}
+	fmt.Fprintf(ofd, "Recognition: %s\n", method)
+	fmt.Fprintf(ofd, "Submitted: %s\n", prov.Submitted.Format(time.RFC3339))
+	fmt.Fprintf(ofd, "Finished: %s\n", prov.Finished.Format(time.RFC3339))
+	_, err := fmt.Fprintf(ofd, "Transcribed by: transcribe %s\n\n", prov.Version)
+	return err
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rjkroege/transcription/resultname"
+)
+
+func TestPrintHeader(t *testing.T) {
+	dir, err := ioutil.TempDir("", "prettyprint")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	fn := filepath.Join(dir, "clip-en-US.json")
+	if prov, err := readprovenance(resultname.Meta(fn)); prov != nil || err != nil {
+		t.Fatalf("missing provenance: got %v, %v", prov, err)
+	}
+
+	meta := `{
+  "source": "gs://audioscratch/clip.wav",
+  "md5": "0123abcd",
+  "speakers": 2,
+  "profile": {"name": "video", "model": "video"},
+  "config": {"language_code": "en-US", "model": "video", "use_enhanced": true, "alternative_language_codes": ["fr-CA"]},
+  "method": "longrunning",
+  "operation": "operations/42",
+  "submitted": "2019-06-01T10:00:00Z",
+  "finished": "2019-06-01T10:20:00Z",
+  "version": "v1.2.0"
+}`
+	if err := ioutil.WriteFile(filepath.Join(dir, "clip-en-US.meta.json"), []byte(meta), 0644); err != nil {
+		t.Fatal(err)
+	}
+	prov, err := readprovenance(resultname.Meta(fn))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	buffy := new(bytes.Buffer)
+	ofd := bufio.NewWriter(buffy)
+	if err := printHeader(prov, ofd); err != nil {
+		t.Fatal(err)
+	}
+	ofd.Flush()
+
+	want := `Source: gs://audioscratch/clip.wav (md5 0123abcd)
+Language: en-US (also fr-CA)
+Model: video, enhanced (profile video)
+Speakers: 2
+Recognition: longrunning operations/42
+Submitted: 2019-06-01T10:00:00Z
+Finished: 2019-06-01T10:20:00Z
+Transcribed by: transcribe v1.2.0
+
+`
+	if got := buffy.String(); got != want {
+		t.Errorf("got header\n%s\nwant\n%s", got, want)
+	}
+}
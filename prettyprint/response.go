@@ -0,0 +1,43 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io/ioutil"
+
+	"github.com/golang/protobuf/jsonpb"
+	speechpb "google.golang.org/genproto/googleapis/cloud/speech/v1p1beta1"
+)
+
+// readresponse reads the transcription in filename. It can be gzip
+// compressed and in canonical proto JSON or the encoding/json form
+// that transcribe used to write.
+func readresponse(filename string) (*speechpb.LongRunningRecognizeResponse, error) {
+	buffy, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	if len(buffy) > 2 && buffy[0] == 0x1f && buffy[1] == 0x8b {
+		zr, err := gzip.NewReader(bytes.NewReader(buffy))
+		if err != nil {
+			return nil, err
+		}
+		if buffy, err = ioutil.ReadAll(zr); err != nil {
+			return nil, err
+		}
+	}
+
+	// The legacy form writes durations as objects which the canonical
+	// decoder rejects.
+	var resp speechpb.LongRunningRecognizeResponse
+	unmarshaler := &jsonpb.Unmarshaler{AllowUnknownFields: true}
+	if err := unmarshaler.Unmarshal(bytes.NewReader(buffy), &resp); err == nil {
+		return &resp, nil
+	}
+	resp = speechpb.LongRunningRecognizeResponse{}
+	if err := json.Unmarshal(buffy, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestReadresponse(t *testing.T) {
+	dir, err := ioutil.TempDir("", "prettyprint")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	legacy := `{"results":[{"alternatives":[{"transcript":"hello","confidence":0.9,"words":[{"start_time":{"seconds":1},"end_time":{"seconds":1,"nanos":500000000},"word":"hello","speaker_tag":2}]}],"language_code":"en-us"}],"profile":{"name":"default"}}`
+	canonical := `{"results":[{"alternatives":[{"transcript":"hello","confidence":0.9,"words":[{"startTime":"1s","endTime":"1.500s","word":"hello","speakerTag":2}]}],"languageCode":"en-us"}]}`
+	zipped := new(bytes.Buffer)
+	zw := gzip.NewWriter(zipped)
+	zw.Write([]byte(canonical))
+	zw.Close()
+
+	tt := []struct {
+		name string
+		data []byte
+	}{
+		{"legacy.json", []byte(legacy)},
+		{"canonical.json", []byte(canonical)},
+		{"zipped.json.gz", zipped.Bytes()},
+	}
+	for _, tv := range tt {
+		fn := filepath.Join(dir, tv.name)
+		if err := ioutil.WriteFile(fn, tv.data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		resp, err := readresponse(fn)
+		if err != nil {
+			t.Errorf("%s: %v", tv.name, err)
+			continue
+		}
+		wi := resp.Results[0].Alternatives[0].Words[0]
+		if got, want := makeWordBundle(wi).end, 1500*time.Millisecond; got != want {
+			t.Errorf("%s: word ends at %v, want %v", tv.name, got, want)
+		}
+		if got, want := wi.SpeakerTag, int32(2); got != want {
+			t.Errorf("%s: speaker %d, want %d", tv.name, got, want)
+		}
+		if got, want := resp.Results[0].LanguageCode, "en-us"; got != want {
+			t.Errorf("%s: language %q, want %q", tv.name, got, want)
+		}
+	}
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"html/template"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/rjkroege/transcription/resultname"
+)
+
+var media = flag.String("media", "%s.mp4", "link the html and md timestamps to this media, %s is replaced by the name of the recording")
+
+// turnpause is the longest pause inside a turn when the speakers weren't
+// recognized.
+const turnpause = 2 * time.Second
+
+// turn is what one speaker said without interruption.
+type turn struct {
+	Speaker string
+	Start   time.Duration
+	End     time.Duration
+	Text    string
+}
+
+// Timestamp is when the turn starts as h:mm:ss.
+func (t *turn) Timestamp() string {
+	s := int64(t.Start / time.Second)
+	return fmt.Sprintf("%d:%02d:%02d", s/3600, s/60%60, s%60)
+}
+
+// Seconds is when the turn starts in seconds.
+func (t *turn) Seconds() int64 {
+	return int64(t.Start / time.Second)
+}
+
+// maketurns groups words into turns. Without speakers, a long pause
+// starts a new turn.
+func maketurns(words []*timedword) []*turn {
+	var turns []*turn
+	var t *turn
+	var last *timedword
+	for _, w := range words {
+		if t == nil || w.speaker != t.Speaker || (w.speaker == "" && w.start-last.end > turnpause) {
+			t = &turn{Speaker: w.speaker, Start: w.start, Text: w.word}
+			turns = append(turns, t)
+		} else {
+			t.Text += " " + w.word
+		}
+		t.End = w.end
+		last = w
+	}
+	return turns
+}
+
+// recordingname is the name of the recording that the transcription
+// filename was made from: without its directory, slice, languages and
+// extension. The languages come from its provenance if it has one.
+func recordingname(filename string) string {
+	langs := resultname.Languages(filename)
+	if base, _, ok := slicenumber(filename); ok {
+		filename = base
+	}
+	return resultname.TrimLanguages(resultname.Trim(filepath.Base(filename)), langs)
+}
+
+// medialink returns the -media link for the recording that the
+// transcription filename was made from.
+func medialink(filename string) string {
+	if !strings.Contains(*media, "%s") {
+		return *media
+	}
+	return fmt.Sprintf(*media, recordingname(filename))
+}
+
+// writemarkdown writes tr as Markdown, one paragraph per turn, with the
+// start of each turn linking to that moment of the media.
+func writemarkdown(tr *transcript, ofd *bufio.Writer) error {
+	link := medialink(tr.filename)
+	if _, err := fmt.Fprintf(ofd, "# %s\n\n", recordingname(tr.filename)); err != nil {
+		return err
+	}
+	for _, t := range maketurns(tr.words()) {
+		speaker := ""
+		if t.Speaker != "" {
+			speaker = "**" + t.Speaker + "** "
+		}
+		if _, err := fmt.Fprintf(ofd, "%s[%s](<%s#t=%d>)\n%s\n\n", speaker, t.Timestamp(), link, t.Seconds(), markdownescaper.Replace(t.Text)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// markdownescaper escapes the characters that would format the text of
+// a turn. Low confidence words are in [brackets].
+var markdownescaper = strings.NewReplacer(`\`, `\\`, "*", `\*`, "_", `\_`, "[", `\[`, "]", `\]`, "<", `\<`, "`", "\\`", "#", `\#`)
+
+// htmltemplate is the page for writehtml. Clicking a timestamp plays
+// the media from there and the turn being played is highlighted.
+var htmltemplate = template.Must(template.New("html").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<style>
+body { font-family: sans-serif; max-width: 50em; margin: 0 auto; }
+#player { position: sticky; top: 0; width: 100%; max-height: 40vh; background: black; }
+.turn { padding: 0.25em 0.5em; border-left: 3px solid transparent; }
+.turn.current { background: #fff6cc; border-left-color: #e0a800; }
+.speaker { font-weight: bold; }
+a.time { color: #555; margin-left: 0.5em; }
+</style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+<video id="player" controls preload="metadata" src="{{.Media}}"></video>
+{{range .Turns}}<div class="turn" data-start="{{.Start.Seconds}}">
+<span class="speaker">{{.Speaker}}</span><a class="time" href="{{$.Media}}#t={{.Seconds}}">{{.Timestamp}}</a>
+<p>{{.Text}}</p>
+</div>
+{{end}}<script>
+var player = document.getElementById("player");
+var turns = document.querySelectorAll(".turn");
+var current = null;
+document.querySelectorAll("a.time").forEach(function(a) {
+	a.addEventListener("click", function(e) {
+		e.preventDefault();
+		player.currentTime = parseFloat(a.parentNode.dataset.start);
+		player.play();
+	});
+});
+player.addEventListener("timeupdate", function() {
+	var now = player.currentTime;
+	var found = null;
+	for (var i = 0; i < turns.length; i++) {
+		if (parseFloat(turns[i].dataset.start) <= now) {
+			found = turns[i];
+		}
+	}
+	if (found === current) {
+		return;
+	}
+	if (current) {
+		current.classList.remove("current");
+	}
+	current = found;
+	if (current) {
+		current.classList.add("current");
+		current.scrollIntoView({block: "nearest"});
+	}
+});
+</script>
+</body>
+</html>
+`))
+
+// writehtml writes tr as a web page with a player for the media. Each
+// turn's timestamp plays the media from that moment and the turn being
+// played is highlighted.
+func writehtml(tr *transcript, ofd *bufio.Writer) error {
+	return htmltemplate.Execute(ofd, struct {
+		Title string
+		Media string
+		Turns []*turn
+	}{
+		Title: recordingname(tr.filename),
+		Media: medialink(tr.filename),
+		Turns: maketurns(tr.words()),
+	})
+}
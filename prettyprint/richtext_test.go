@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	speechpb "google.golang.org/genproto/googleapis/cloud/speech/v1p1beta1"
+)
+
+// slicetranscript is a transcript of the second slice of talk where
+// speaker 1 is named.
+func slicetranscript() *transcript {
+	words := []*speechpb.WordInfo{word("hi", 0, 1), word("<there>", 1, 2), word("bye_now", 5, 6)}
+	words[0].SpeakerTag, words[1].SpeakerTag, words[2].SpeakerTag = 1, 1, 2
+	return &transcript{
+		filename: "dir/talk-<1>-en-US.json",
+		resp: &speechpb.LongRunningRecognizeResponse{
+			Results: []*speechpb.SpeechRecognitionResult{
+				{Alternatives: []*speechpb.SpeechRecognitionAlternative{{Words: words}}},
+			},
+		},
+		offset: slicestep,
+		names:  speakernames{"SPEAKER_1": "Alice"},
+	}
+}
+
+func TestRecordingname(t *testing.T) {
+	for fn, want := range map[string]string{
+		"dir/talk-<1>-en-US.json":        "talk",
+		"talk-en-US+en-AU.json.gz":       "talk",
+		"talk-en-US.json":                "talk",
+		"_04-22-_Original-Media_Clip-,3": "_04-22-_Original-Media_Clip-,3",
+		"big-day-en-US.json":             "big-day",
+		"talk-two-en-US.json":            "talk-two",
+		"interview-one.json":             "interview-one",
+		"my-big-day.json":                "my-big-day",
+		"talk-cmn-Hans-CN.json":          "talk",
+		"talk-es-419+en-US.json":         "talk",
+	} {
+		if got := recordingname(fn); got != want {
+			t.Errorf("%s: got %q, want %q", fn, got, want)
+		}
+	}
+
+	// The provenance says exactly which languages were added.
+	dir, err := ioutil.TempDir("", "prettyprint")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	fn := filepath.Join(dir, "talk-<1>-fr.json")
+	if err := ioutil.WriteFile(filepath.Join(dir, "talk-<1>-fr.meta.json"), []byte(`{"config": {"language_code": "fr"}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := recordingname(fn), "talk"; got != want {
+		t.Errorf("%s: got %q, want %q", fn, got, want)
+	}
+}
+
+func TestWritemarkdown(t *testing.T) {
+	buffy := new(bytes.Buffer)
+	w := bufio.NewWriter(buffy)
+	if err := writemarkdown(slicetranscript(), w); err != nil {
+		t.Fatal(err)
+	}
+	w.Flush()
+	want := "# talk\n\n**Alice** [0:45:00](<talk.mp4#t=2700>)\nhi \\<there>\n\n**SPEAKER_2** [0:45:05](<talk.mp4#t=2705>)\nbye\\_now\n\n"
+	if got := buffy.String(); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestWritehtml(t *testing.T) {
+	defer func(old string) { *media = old }(*media)
+	*media = "https://example.com/videos/%s.mp4"
+
+	buffy := new(bytes.Buffer)
+	w := bufio.NewWriter(buffy)
+	if err := writehtml(slicetranscript(), w); err != nil {
+		t.Fatal(err)
+	}
+	w.Flush()
+	page := buffy.String()
+	for _, want := range []string{
+		`<video id="player" controls preload="metadata" src="https://example.com/videos/talk.mp4">`,
+		`<div class="turn" data-start="2700">`,
+		`<span class="speaker">Alice</span><a class="time" href="https://example.com/videos/talk.mp4#t=2700">0:45:00</a>`,
+		`<span class="speaker">SPEAKER_2</span><a class="time" href="https://example.com/videos/talk.mp4#t=2705">0:45:05</a>`,
+		`<p>hi &lt;there&gt;</p>`,
+		`classList.add("current")`,
+	} {
+		if !strings.Contains(page, want) {
+			t.Errorf("page doesn't have %s:\n%s", want, page)
+		}
+	}
+}
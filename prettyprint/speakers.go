@@ -0,0 +1,142 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/rjkroege/transcription/resultname"
+)
+
+// Speaker name files. A transcription's own names override the names
+// for its directory.
+const (
+	speakersuffix = ".speakers.json"
+	speakersname  = "speakers.json"
+)
+
+// Limits on the report of the speakers without names.
+const (
+	reportturns = 3
+	reportwords = 12
+)
+
+// speakernames maps speaker labels like SPEAKER_1 or CHANNEL_2 to the
+// names to show.
+type speakernames map[string]string
+
+// readspeakernamefile reads the speaker names in fn. Returns nil if
+// there's no such file.
+func readspeakernamefile(fn string) (speakernames, error) {
+	buffy, err := ioutil.ReadFile(fn)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	names := make(speakernames)
+	if err := json.Unmarshal(buffy, &names); err != nil {
+		return nil, fmt.Errorf("%s: %v", fn, err)
+	}
+	return names, nil
+}
+
+// readspeakernames reads the speaker names for the transcription
+// filename from speakers.json in its directory and its own
+// .speakers.json file.
+func readspeakernames(filename string) (speakernames, error) {
+	names := make(speakernames)
+	for _, fn := range []string{
+		filepath.Join(filepath.Dir(filename), speakersname),
+		resultname.Trim(filename) + speakersuffix,
+	} {
+		more, err := readspeakernamefile(fn)
+		if err != nil {
+			return nil, err
+		}
+		for k, v := range more {
+			names[k] = v
+		}
+	}
+	return names, nil
+}
+
+// name returns the name for the speaker label, or the label if it has
+// no name.
+func (names speakernames) name(label string) string {
+	if n, ok := names[label]; ok && n != "" {
+		return n
+	}
+	return label
+}
+
+// rename replaces the speaker labels of words with their names.
+func (names speakernames) rename(words []*timedword) {
+	for _, w := range words {
+		w.speaker = names.name(w.speaker)
+	}
+}
+
+// renamebundles replaces the speaker labels of speakers with their names.
+func (names speakernames) renamebundles(speakers SpeakersType) {
+	for _, utterances := range speakers {
+		for _, wb := range utterances {
+			wb.speaker = names.name(wb.speaker)
+		}
+	}
+}
+
+// reportunnamed writes the first few turns of each speaker in words
+// that has no name so that they can be identified.
+func reportunnamed(o io.Writer, filename string, words []*timedword, names speakernames) error {
+	turns := make(map[string][]string)
+	var labels []string
+	for i := 0; i < len(words); {
+		label := words[i].speaker
+		k := i
+		for ; k < len(words) && words[k].speaker == label; k++ {
+		}
+		if _, named := names[label]; label != "" && !named {
+			if _, seen := turns[label]; !seen {
+				labels = append(labels, label)
+			}
+			if len(turns[label]) < reportturns {
+				turn := make([]string, 0, reportwords)
+				for _, w := range words[i:k] {
+					if len(turn) == reportwords {
+						turn = append(turn, "...")
+						break
+					}
+					turn = append(turn, w.word)
+				}
+				turns[label] = append(turns[label], fmt.Sprintf("%s %s", words[i].start, strings.Join(turn, " ")))
+			}
+		}
+		i = k
+	}
+	if len(labels) == 0 {
+		return nil
+	}
+
+	sort.Strings(labels)
+	if _, err := fmt.Fprintf(o, "%s: speakers without names in %s or %s:\n", filename, speakersname, resultname.Trim(filepath.Base(filename))+speakersuffix); err != nil {
+		return err
+	}
+	for _, label := range labels {
+		if _, err := fmt.Fprintf(o, "  %s:\n", label); err != nil {
+			return err
+		}
+		for _, t := range turns[label] {
+			if _, err := fmt.Fprintf(o, "    %s\n", t); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
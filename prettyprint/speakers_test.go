@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestReadspeakernames(t *testing.T) {
+	dir, err := ioutil.TempDir("", "prettyprint")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	fn := filepath.Join(dir, "clip-en-US.json.gz")
+
+	names, err := readspeakernames(fn)
+	if err != nil || len(names) != 0 {
+		t.Fatalf("no name files gave %v, %v", names, err)
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(dir, speakersname), []byte(`{"SPEAKER_1": "Robert", "SPEAKER_2": "Alice"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "clip-en-US"+speakersuffix), []byte(`{"SPEAKER_2": "Kate"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	names, err = readspeakernames(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for label, want := range map[string]string{"SPEAKER_1": "Robert", "SPEAKER_2": "Kate", "SPEAKER_3": "SPEAKER_3"} {
+		if got := names.name(label); got != want {
+			t.Errorf("%s is named %q, want %q", label, got, want)
+		}
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(dir, speakersname), []byte(`["Robert"]`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := readspeakernames(fn); err == nil {
+		t.Error("bad names file was read")
+	}
+}
+
+func TestReportunnamed(t *testing.T) {
+	var words []*timedword
+	for i, s := range []string{"SPEAKER_1", "SPEAKER_2", "SPEAKER_2", "SPEAKER_3", "SPEAKER_2", "SPEAKER_1", "SPEAKER_2", "SPEAKER_3", "SPEAKER_2"} {
+		words = append(words, &timedword{word: "w" + string(rune('a'+i)), speaker: s, start: time.Duration(i) * time.Second})
+	}
+	buffy := new(bytes.Buffer)
+	if err := reportunnamed(buffy, "clip.json", words, speakernames{"SPEAKER_1": "Robert"}); err != nil {
+		t.Fatal(err)
+	}
+	want := `clip.json: speakers without names in speakers.json or clip.speakers.json:
+  SPEAKER_2:
+    1s wb wc
+    4s we
+    6s wg
+  SPEAKER_3:
+    3s wd
+    7s wh
+`
+	if got := buffy.String(); got != want {
+		t.Errorf("got report\n%s\nwant\n%s", got, want)
+	}
+
+	buffy.Reset()
+	reportunnamed(buffy, "clip.json", words, speakernames{"SPEAKER_1": "Robert", "SPEAKER_2": "Alice", "SPEAKER_3": "Kate"})
+	if buffy.Len() != 0 {
+		t.Errorf("reported named speakers: %s", buffy)
+	}
+}
@@ -0,0 +1,287 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes"
+	speechpb "google.golang.org/genproto/googleapis/cloud/speech/v1p1beta1"
+)
+
+// prepaudio cuts long recordings into slices of slicelength starting
+// every slicestep so neighbouring slices share sliceoverlap of audio.
+const (
+	slicestep    = 2700 * time.Second
+	slicelength  = 3000 * time.Second
+	sliceoverlap = slicelength - slicestep
+)
+
+// Limits on matching the words of the overlap.
+const (
+	overlapslack = 5 * time.Second         // Words this far outside the overlap are also aligned.
+	matchslack   = 1500 * time.Millisecond // Matching words start no further apart than this.
+
+	minspeakermatch = 3 // Speakers are the same if they said this many of the same words.
+)
+
+// slicenumber returns the name of the recording that the transcription
+// filename is a slice of and which slice it is.
+func slicenumber(filename string) (string, int, bool) {
+	loc := fnripper.FindStringSubmatchIndex(filename)
+	if loc == nil {
+		return "", 0, false
+	}
+	n, err := strconv.Atoi(filename[loc[2]:loc[3]])
+	if err != nil {
+		return "", 0, false
+	}
+	start := loc[0]
+	if start > 0 && filename[start-1] == '-' {
+		start--
+	}
+	return filename[:start] + filename[loc[1]:], n, true
+}
+
+// groupslices sorts the transcriptions in filenames into the recordings
+// that they are slices of, ordered by slice. Transcriptions that aren't
+// slices are returned separately.
+func groupslices(filenames []string) (map[string][]string, []string) {
+	recordings := make(map[string][]string)
+	numbers := make(map[string]int)
+	var whole []string
+	for _, fn := range filenames {
+		base, n, ok := slicenumber(fn)
+		if !ok {
+			whole = append(whole, fn)
+			continue
+		}
+		recordings[base] = append(recordings[base], fn)
+		numbers[fn] = n
+	}
+	for _, slices := range recordings {
+		sort.Slice(slices, func(i, k int) bool { return numbers[slices[i]] < numbers[slices[k]] })
+	}
+	return recordings, whole
+}
+
+// normalword is w reduced to what must match in the overlap.
+func normalword(w string) string {
+	return strings.ToLower(strings.TrimFunc(w, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}))
+}
+
+// alignoverlap returns the pairs of indices of a and b that are the same
+// word spoken at about the same time. It finds the longest such common
+// subsequence.
+func alignoverlap(a, b []*timedword) [][2]int {
+	matches := func(i, k int) bool {
+		d := a[i].start - b[k].start
+		if d < 0 {
+			d = -d
+		}
+		return d <= matchslack && normalword(a[i].word) == normalword(b[k].word)
+	}
+
+	// lcs[i][k] is the length of the longest common subsequence of a[i:]
+	// and b[k:].
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for k := len(b) - 1; k >= 0; k-- {
+			switch {
+			case matches(i, k):
+				lcs[i][k] = lcs[i+1][k+1] + 1
+			case lcs[i+1][k] >= lcs[i][k+1]:
+				lcs[i][k] = lcs[i+1][k]
+			default:
+				lcs[i][k] = lcs[i][k+1]
+			}
+		}
+	}
+
+	var pairs [][2]int
+	for i, k := 0, 0; i < len(a) && k < len(b); {
+		switch {
+		case matches(i, k) && lcs[i][k] == lcs[i+1][k+1]+1:
+			pairs = append(pairs, [2]int{i, k})
+			i++
+			k++
+		case lcs[i+1][k] >= lcs[i][k+1]:
+			i++
+		default:
+			k++
+		}
+	}
+	return pairs
+}
+
+// overlapwords returns where the words of the overlap between before and
+// the slice starting at offset begin in before and end in slice.
+func overlapwords(before, slice []*timedword, offset time.Duration) (int, int) {
+	tail := sort.Search(len(before), func(i int) bool { return before[i].start >= offset-overlapslack })
+	head := sort.Search(len(slice), func(i int) bool { return slice[i].start >= offset+sliceoverlap+overlapslack })
+	return tail, head
+}
+
+// stitchslice appends the words of the slice starting at offset to the
+// words before it, dropping the words that both recognized in their
+// overlap. pairs align before[tail:] with the start of slice. The seam
+// is at the aligned word nearest the middle of the overlap, where both
+// slices have plenty of context, or at the middle if no words align.
+func stitchslice(before, slice []*timedword, offset time.Duration, tail int, pairs [][2]int) []*timedword {
+	mid := offset + sliceoverlap/2
+	if len(pairs) == 0 {
+		cut := sort.Search(len(before), func(i int) bool { return before[i].start >= mid })
+		from := sort.Search(len(slice), func(i int) bool { return slice[i].start >= mid })
+		return append(before[:cut:cut], slice[from:]...)
+	}
+
+	seam := pairs[0]
+	for _, p := range pairs[1:] {
+		if absduration(before[tail+p[0]].start-mid) < absduration(before[tail+seam[0]].start-mid) {
+			seam = p
+		}
+	}
+	cut := tail + seam[0]
+	return append(before[:cut:cut], slice[seam[1]:]...)
+}
+
+// matchspeakers returns which speaker tag in a each speaker tag in b
+// is, judging by who said the aligned words in pairs. The speakers who
+// said the most words in common are matched first. A speaker in b is
+// only matched on at least minspeakermatch words.
+func matchspeakers(a, b []*timedword, pairs [][2]int) map[int32]int32 {
+	type tagpair struct{ a, b int32 }
+	counts := make(map[tagpair]int)
+	for _, p := range pairs {
+		if ta, tb := a[p[0]].tag, b[p[1]].tag; ta > 0 && tb > 0 {
+			counts[tagpair{ta, tb}]++
+		}
+	}
+	candidates := make([]tagpair, 0, len(counts))
+	for tp := range counts {
+		candidates = append(candidates, tp)
+	}
+	sort.Slice(candidates, func(i, k int) bool {
+		ci, ck := counts[candidates[i]], counts[candidates[k]]
+		if ci != ck {
+			return ci > ck
+		}
+		if candidates[i].b != candidates[k].b {
+			return candidates[i].b < candidates[k].b
+		}
+		return candidates[i].a < candidates[k].a
+	})
+
+	mapping := make(map[int32]int32)
+	taken := make(map[int32]bool)
+	for _, tp := range candidates {
+		if counts[tp] < minspeakermatch {
+			break
+		}
+		if _, done := mapping[tp.b]; done || taken[tp.a] {
+			continue
+		}
+		mapping[tp.b] = tp.a
+		taken[tp.a] = true
+	}
+	return mapping
+}
+
+// relabel changes the speaker tags of words with mapping. Speakers that
+// aren't in mapping get new tags from *next on.
+func relabel(words []*timedword, mapping map[int32]int32, next *int32) {
+	for _, w := range words {
+		if w.tag == 0 {
+			continue
+		}
+		tag, ok := mapping[w.tag]
+		if !ok {
+			tag = *next
+			*next++
+			mapping[w.tag] = tag
+		}
+		w.tag = tag
+		w.speaker = fmt.Sprintf("SPEAKER_%d", tag)
+	}
+}
+
+// absduration is the magnitude of d.
+func absduration(d time.Duration) time.Duration {
+	if d < 0 {
+		return -d
+	}
+	return d
+}
+
+// stitchslices puts the words of the slices of a recording, ordered by
+// slice, on the timeline of the whole recording without repeating the
+// overlaps. Each slice's speakers were recognized on their own so they
+// are relabelled to match the speakers of the slice before.
+func stitchslices(slices [][]*timedword, offsets []time.Duration) []*timedword {
+	var words []*timedword
+	next := int32(1)
+	for i, slice := range slices {
+		if i == 0 {
+			for _, w := range slice {
+				if w.tag >= next {
+					next = w.tag + 1
+				}
+			}
+			words = append(words, slice...)
+			continue
+		}
+		if offsets[i]-offsets[i-1] != slicestep {
+			log.Printf("slices at %v and %v aren't neighbours, not removing their overlap or matching their speakers", offsets[i-1], offsets[i])
+			relabel(slice, make(map[int32]int32), &next)
+			words = append(words, slice...)
+			continue
+		}
+
+		tail, head := overlapwords(words, slice, offsets[i])
+		pairs := alignoverlap(words[tail:], slice[:head])
+		relabel(slice, matchspeakers(words[tail:], slice[:head], pairs), &next)
+		words = stitchslice(words, slice, offsets[i], tail, pairs)
+	}
+	return words
+}
+
+// stitchedresponse makes a response holding words, recognized at their
+// place on the timeline. Channels stay separate. Speakers are in the one
+// result as they are when the API recognizes speakers.
+func stitchedresponse(words []*timedword) *speechpb.LongRunningRecognizeResponse {
+	resp := new(speechpb.LongRunningRecognizeResponse)
+	results := make(map[int32]*speechpb.SpeechRecognitionResult)
+	for _, w := range words {
+		r, ok := results[w.channel]
+		if !ok {
+			r = &speechpb.SpeechRecognitionResult{
+				ChannelTag:   w.channel,
+				Alternatives: []*speechpb.SpeechRecognitionAlternative{{}},
+			}
+			results[w.channel] = r
+			resp.Results = append(resp.Results, r)
+		}
+		alt := r.Alternatives[0]
+
+		wi := proto.Clone(w.info).(*speechpb.WordInfo)
+		wi.StartTime = ptypes.DurationProto(w.start)
+		wi.EndTime = ptypes.DurationProto(w.end)
+		wi.SpeakerTag = w.tag
+		alt.Words = append(alt.Words, wi)
+		if alt.Transcript != "" {
+			alt.Transcript += " "
+		}
+		alt.Transcript += wi.Word
+	}
+	return resp
+}
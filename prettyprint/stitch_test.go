@@ -0,0 +1,210 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	speechpb "google.golang.org/genproto/googleapis/cloud/speech/v1p1beta1"
+)
+
+func TestGroupslices(t *testing.T) {
+	recordings, whole := groupslices([]string{
+		"talk-<1>-en-US.json", "dir/talk-<0>-en-US.json", "talk-<10>-en-US.json.gz", "talk-<0>-en-US.json", "clip-en-US.json",
+	})
+	want := map[string][]string{
+		"talk-en-US.json":     {"talk-<0>-en-US.json", "talk-<1>-en-US.json"},
+		"talk-en-US.json.gz":  {"talk-<10>-en-US.json.gz"},
+		"dir/talk-en-US.json": {"dir/talk-<0>-en-US.json"},
+	}
+	if !reflect.DeepEqual(recordings, want) {
+		t.Errorf("grouped %v, want %v", recordings, want)
+	}
+	if !reflect.DeepEqual(whole, []string{"clip-en-US.json"}) {
+		t.Errorf("left %v", whole)
+	}
+}
+
+// recording makes the words w0, w1... of a recording, one every 2
+// seconds, keeping those spoken from start to end.
+func recording(start, end time.Duration) []*timedword {
+	var words []*timedword
+	for t := time.Duration(0); t < end; t += 2 * time.Second {
+		if t >= start {
+			words = append(words, &timedword{word: fmt.Sprintf("w%d", t/(2*time.Second)), start: t, end: t + time.Second})
+		}
+	}
+	return words
+}
+
+// wordlist is the words of words separated by spaces.
+func wordlist(words []*timedword) string {
+	list := make([]string, 0, len(words))
+	for _, w := range words {
+		list = append(list, w.word)
+	}
+	return strings.Join(list, " ")
+}
+
+func TestStitchslices(t *testing.T) {
+	offsets := []time.Duration{0, slicestep, 2 * slicestep}
+	var slices [][]*timedword
+	for _, o := range offsets {
+		slices = append(slices, recording(o, o+slicelength))
+	}
+	// The ends of the slices are misheard.
+	slices[0][len(slices[0])-1].word = "huh"
+	slices[1][0].word = "what"
+	slices[1][1].word = "W3?"
+
+	want := wordlist(recording(0, 2*slicestep+slicelength))
+	if got := wordlist(stitchslices(slices, offsets)); got != want {
+		t.Errorf("stitched\n%s\nwant\n%s", got, want)
+	}
+
+	// Without anything in common, the seam is in the middle.
+	for _, w := range slices[2] {
+		w.word = "x" + w.word
+	}
+	got := stitchslices(slices[1:], offsets[1:])
+	for i, w := range got {
+		switch {
+		case w.start < 2*slicestep+sliceoverlap/2 && strings.HasPrefix(w.word, "x"):
+			t.Fatalf("word %d at %v is from the wrong slice", i, w.start)
+		case w.start >= 2*slicestep+sliceoverlap/2 && !strings.HasPrefix(w.word, "x"):
+			t.Fatalf("word %d at %v is from the wrong slice", i, w.start)
+		case i > 0 && w.start <= got[i-1].start:
+			t.Fatalf("word %d at %v is out of order", i, w.start)
+		}
+	}
+}
+
+func TestStitchedresponse(t *testing.T) {
+	a, b := word("hi", 0, 1), word("there", 1, 2)
+	a.SpeakerTag, b.SpeakerTag = 1, 2
+	words := []*timedword{
+		{word: "hi", tag: 1, start: slicestep, end: slicestep + time.Second, info: a},
+		{word: "there", tag: 2, start: slicestep + time.Second, end: slicestep + 2*time.Second, info: b},
+	}
+	resp := stitchedresponse(words)
+	if len(resp.Results) != 1 {
+		t.Fatalf("got %d results", len(resp.Results))
+	}
+	alt := resp.Results[0].Alternatives[0]
+	if alt.Transcript != "hi there" || len(alt.Words) != 2 || alt.Words[1].SpeakerTag != 2 || alt.Words[1].StartTime.Seconds != 2701 {
+		t.Errorf("got %v", alt)
+	}
+	if a.StartTime.Seconds != 0 {
+		t.Error("changed the slice's words")
+	}
+}
+
+func TestStitchspeakers(t *testing.T) {
+	offsets := []time.Duration{0, slicestep}
+	slices := [][]*timedword{recording(0, slicelength), recording(slicestep, slicestep+slicelength)}
+
+	// Alice says 10 words, then Bob 10 and so on. The second slice calls
+	// Alice 2 and Bob 3.
+	for i, slice := range slices {
+		for _, w := range slice {
+			alice := w.start/(20*time.Second)%2 == 0
+			switch {
+			case i == 0 && alice:
+				w.tag = 1
+			case i == 0:
+				w.tag = 2
+			case alice:
+				w.tag = 2
+			default:
+				w.tag = 3
+			}
+			w.speaker = fmt.Sprintf("SPEAKER_%d", w.tag)
+		}
+	}
+	// Someone who only speaks in the second slice.
+	slices[1][len(slices[1])-1].tag = 1
+	slices[1][len(slices[1])-1].speaker = "SPEAKER_1"
+
+	words := stitchslices(slices, offsets)
+	for i, w := range words[:len(words)-1] {
+		want := int32(2)
+		if w.start/(20*time.Second)%2 == 0 {
+			want = 1
+		}
+		if w.tag != want || w.speaker != fmt.Sprintf("SPEAKER_%d", want) {
+			t.Fatalf("word %d at %v is said by %d (%s), want %d", i, w.start, w.tag, w.speaker, want)
+		}
+	}
+	if got, want := words[len(words)-1].tag, int32(3); got != want {
+		t.Errorf("new speaker is %d, want %d", got, want)
+	}
+}
+
+func TestMatchspeakers(t *testing.T) {
+	a := []*timedword{{tag: 1}, {tag: 1}, {tag: 1}, {tag: 2}, {tag: 2}, {tag: 2}, {tag: 2}}
+	b := []*timedword{{tag: 5}, {tag: 5}, {tag: 5}, {tag: 5}, {tag: 6}, {tag: 6}, {tag: 6}}
+	pairs := [][2]int{{0, 0}, {1, 1}, {2, 2}, {3, 3}, {4, 4}, {5, 5}, {6, 6}}
+
+	// 5 said three of 1's words and one of 2's.
+	want := map[int32]int32{5: 1, 6: 2}
+	if got := matchspeakers(a, b, pairs); !reflect.DeepEqual(got, want) {
+		t.Errorf("matched %v, want %v", got, want)
+	}
+	// Too few words in common.
+	if got := matchspeakers(a, b, pairs[:2]); len(got) != 0 {
+		t.Errorf("matched %v on two words", got)
+	}
+}
+
+func TestStitchUndiarized(t *testing.T) {
+	// Slices whose speakers weren't recognized stitch into a plain
+	// transcript.
+	slices := [][]*timedword{recording(0, slicelength), recording(slicestep, slicestep+slicelength)}
+	for _, slice := range slices {
+		for _, w := range slice {
+			w.info = &speechpb.WordInfo{Word: w.word}
+		}
+	}
+	resp := stitchedresponse(stitchslices(slices, []time.Duration{0, slicestep}))
+	got := strings.Join(strings.Fields(writetxtstring(t, &transcript{filename: "testdata/none.json", resp: resp})), " ")
+	if want := wordlist(recording(0, slicestep+slicelength)); got != want {
+		t.Errorf("got %q, want the words of the recording", got)
+	}
+}
+
+func TestStitchNoWordTimes(t *testing.T) {
+	dir, err := ioutil.TempDir("", "stitch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	// The default profile has no word times.
+	withtimes := `{"results": [{"alternatives": [{"transcript": "hi", "words": [{"word": "hi", "startTime": "1s", "endTime": "2s"}]}]}]}`
+	without := `{"results": [{"alternatives": [{"transcript": "there"}]}]}`
+	filenames := []string{"talk-<0>.json", "talk-<1>.json"}
+	for i, js := range []string{withtimes, without} {
+		if err := ioutil.WriteFile(filenames[i], []byte(js), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := dostitch("talk.json", filenames); err == nil {
+		t.Error("stitched a slice without word times")
+	}
+	if _, err := os.Stat("talk.txt"); !os.IsNotExist(err) {
+		t.Errorf("wrote talk.txt: %v", err)
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/golang/protobuf/ptypes/duration"
+	speechpb "google.golang.org/genproto/googleapis/cloud/speech/v1p1beta1"
+)
+
+// timedword is a word placed on the timeline of the original recording.
+type timedword struct {
+	word    string
+	speaker string // Empty if the speakers weren't recognized.
+	tag     int32  // The speaker tag, 0 if the speakers weren't recognized.
+	start   time.Duration
+	end     time.Duration
+	channel int32
+	info    *speechpb.WordInfo // As recognized, before the offset.
+}
+
+// wordtime converts a word time offset. Missing offsets are 0.
+func wordtime(d *duration.Duration) time.Duration {
+	return time.Duration(d.GetSeconds())*time.Second + time.Duration(d.GetNanos())
+}
+
+// diarized returns true if the speakers of resp were recognized. With
+// diarization, the last result repeats all of the words with their
+// speakers.
+func diarized(resp *speechpb.LongRunningRecognizeResponse) bool {
+	n := len(resp.Results)
+	if n == 0 || len(resp.Results[n-1].Alternatives) == 0 {
+		return false
+	}
+	last := resp.Results[n-1].Alternatives[0].Words
+	return len(last) > 0 && last[0].SpeakerTag > 0
+}
+
+// timedwords returns the words of resp in the order spoken, shifted by
+// offset. Words are labelled with their channel if the channels were
+// recognized separately and with their speaker if the speakers were.
+func timedwords(resp *speechpb.LongRunningRecognizeResponse, offset time.Duration) []*timedword {
+	var words []*timedword
+	add := func(wi *speechpb.WordInfo, speaker string, tag, channel int32) {
+		// Words only have times if the profile asked for them.
+		if wi.StartTime == nil {
+			return
+		}
+		words = append(words, &timedword{
+			word:    markword(wi),
+			speaker: speaker,
+			tag:     tag,
+			start:   offset + wordtime(wi.StartTime),
+			end:     offset + wordtime(wi.EndTime),
+			channel: channel,
+			info:    wi,
+		})
+	}
+
+	if aggregateChannels(resp) != nil {
+		for _, r := range resp.Results {
+			if r.ChannelTag == 0 || len(r.Alternatives) == 0 {
+				continue
+			}
+			for _, wi := range r.Alternatives[0].Words {
+				add(wi, fmt.Sprintf("CHANNEL_%d", r.ChannelTag), 0, r.ChannelTag)
+			}
+		}
+		sort.SliceStable(words, func(i, k int) bool { return words[i].start < words[k].start })
+		return words
+	}
+
+	if diarized(resp) {
+		for _, wi := range resp.Results[len(resp.Results)-1].Alternatives[0].Words {
+			add(wi, fmt.Sprintf("SPEAKER_%d", wi.SpeakerTag), wi.SpeakerTag, 0)
+		}
+		return words
+	}
+
+	for _, r := range resp.Results {
+		if len(r.Alternatives) == 0 {
+			continue
+		}
+		for _, wi := range r.Alternatives[0].Words {
+			add(wi, "", 0, r.ChannelTag)
+		}
+	}
+	return words
+}
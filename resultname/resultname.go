@@ -0,0 +1,68 @@
+// Package resultname knows how transcribe names its results so that the
+// tools reading them can find the audio and recording that a result was
+// made from.
+package resultname
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// MetaSuffix ends the name of the provenance sidecar that transcribe
+// writes next to each result.
+const MetaSuffix = ".meta.json"
+
+// languages matches the languages that transcribe adds to the end of the
+// name of a result, e.g. -en-US, -es-419, -cmn-Hans-CN or
+// -en-US+en-AU+fr-CA. Each needs a region so that the words of a name
+// like big-day aren't taken for a language.
+var languages = regexp.MustCompile(`-[a-z]{2,3}(-[A-Z][a-z]{3})?-([A-Z]{2}|[0-9]{3})(\+[a-z]{2,3}(-[A-Z][a-z]{3})?-([A-Z]{2}|[0-9]{3}))*$`)
+
+// Trim returns filename without its extension, usually .json, and the
+// .gz of a compressed result.
+func Trim(filename string) string {
+	filename = strings.TrimSuffix(filename, ".gz")
+	return strings.TrimSuffix(filename, filepath.Ext(filename))
+}
+
+// Meta returns the name of the provenance sidecar of the result
+// filename.
+func Meta(filename string) string {
+	return Trim(filename) + MetaSuffix
+}
+
+// TrimLanguages returns name, without its extension, less the languages
+// that transcribe added to it. langs are the languages that it was
+// transcribed in. Without them, a trailing group of languages with
+// regions is removed.
+func TrimLanguages(name string, langs []string) string {
+	if len(langs) > 0 {
+		return strings.TrimSuffix(name, "-"+strings.Join(langs, "+"))
+	}
+	return languages.ReplaceAllString(name, "")
+}
+
+// Languages returns the languages that the result filename was
+// transcribed in, as recorded in its provenance sidecar, or nil if
+// there's no readable sidecar.
+func Languages(filename string) []string {
+	fd, err := os.Open(Meta(filename))
+	if err != nil {
+		return nil
+	}
+	defer fd.Close()
+
+	var prov struct {
+		Config *struct {
+			LanguageCode             string   `json:"language_code"`
+			AlternativeLanguageCodes []string `json:"alternative_language_codes"`
+		} `json:"config"`
+	}
+	if err := json.NewDecoder(fd).Decode(&prov); err != nil || prov.Config == nil || prov.Config.LanguageCode == "" {
+		return nil
+	}
+	return append([]string{prov.Config.LanguageCode}, prov.Config.AlternativeLanguageCodes...)
+}
@@ -0,0 +1,56 @@
+package resultname
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestTrimLanguages(t *testing.T) {
+	for _, tv := range []struct {
+		name  string
+		langs []string
+		want  string
+	}{
+		{"clip-en-US", nil, "clip"},
+		{"big-day-en-US", nil, "big-day"},
+		{"interview-one", nil, "interview-one"},
+		{"my-big-day", nil, "my-big-day"},
+		{"clip-en-US+en-AU+fr-CA", nil, "clip"},
+		{"clip-yue-Hant-HK", nil, "clip"},
+		{"clip-es-419", nil, "clip"},
+		{"clip-<1>-fr", []string{"fr"}, "clip-<1>"},
+		{"big-day-en-US+fr-CA", []string{"en-US", "fr-CA"}, "big-day"},
+		{"big-day", []string{"en-US"}, "big-day"},
+	} {
+		if got := TrimLanguages(tv.name, tv.langs); got != tv.want {
+			t.Errorf("%s with %v: got %q, want %q", tv.name, tv.langs, got, tv.want)
+		}
+	}
+
+	if got, want := Trim("zipped-en-US.json.gz"), "zipped-en-US"; got != want {
+		t.Errorf("Trim got %q, want %q", got, want)
+	}
+}
+
+func TestLanguages(t *testing.T) {
+	dir, err := ioutil.TempDir("", "resultname")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	fn := filepath.Join(dir, "clip-en-US+fr-CA.json.gz")
+	if got := Languages(fn); got != nil {
+		t.Errorf("got %v without provenance", got)
+	}
+	meta := `{"config": {"language_code": "en-US", "alternative_language_codes": ["fr-CA"]}}`
+	if err := ioutil.WriteFile(Meta(fn), []byte(meta), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := Languages(fn), []string{"en-US", "fr-CA"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
@@ -9,6 +9,8 @@ import (
 	"path/filepath"
 	"sort"
 	"strings"
+
+	"github.com/rjkroege/transcription/resultname"
 )
 
 var dirroot = flag.String("root", ".", "directories of media should be relative to this")
@@ -155,11 +157,11 @@ func main() {
 
 	ofd, err := os.Create(*ofile)
 	if err != nil {
-		log.Fatalf("can't make output:", err)
+		log.Fatalf("can't make output: %v", err)
 	}
 	owr := csv.NewWriter(ofd)
 	if err := owr.WriteAll(outputtable); err != nil {
-		log.Fatalf("can't write output:", err)
+		log.Fatalf("can't write output: %v", err)
 	}
 	ofd.Close()
 }
@@ -173,17 +175,27 @@ func (a ColumnZero) Less(i, j int) bool { return a[i][0] < a[j][0] }
 type Updater func(v *Row, path, data string) *Row
 
 func mapmaker(path, ext, pext string, pmap map[string]*Row, vupdater Updater) map[string]*Row {
-	globpath := filepath.Join(*dirroot, path, "*"+ext)
-	globbers, err := filepath.Glob(globpath)
-	if err != nil {
-		log.Fatalf("can't glob %s: %v", globpath, err)
+	// Results saved with -gzip end in .json.gz.
+	var globbers []string
+	for _, e := range []string{ext, ext + ".gz"} {
+		globpath := filepath.Join(*dirroot, path, "*"+e)
+		matches, err := filepath.Glob(globpath)
+		if err != nil {
+			log.Fatalf("can't glob %s: %v", globpath, err)
+		}
+		globbers = append(globbers, matches...)
 	}
 
 	fmap := make(map[string]*Row)
 	for _, jf := range globbers {
 		bp := filepath.Base(jf)
-		rp := strings.TrimSuffix(bp, filepath.Ext(bp))
-		rpa := strings.TrimSuffix(rp, "-en-AU") + pext
+		// Skip the provenance sidecars that transcribe writes and the
+		// speaker names for prettyprint.
+		if strings.HasSuffix(bp, resultname.MetaSuffix) || strings.HasSuffix(bp, ".speakers.json") || bp == "speakers.json" {
+			continue
+		}
+		rp := resultname.Trim(bp)
+		rpa := resultname.TrimLanguages(rp, resultname.Languages(jf)) + pext
 		rp = rp + pext
 
 		fi, err := os.Stat(jf)
@@ -191,10 +203,11 @@ func mapmaker(path, ext, pext string, pmap map[string]*Row, vupdater Updater) ma
 			log.Fatalf("%s can't stat: %v\n", jf, err)
 		}
 
+		// The file it was made from may be gzipped too.
 		// log.Println(bp, rp, rpa)
-		if v, ok := pmap[rp]; ok {
+		if v, ok := lookup(pmap, rp); ok {
 			fmap[bp] = vupdater(v, bp, fi.ModTime().Format(outputlayout))
-		} else if v, ok := pmap[rpa]; ok {
+		} else if v, ok := lookup(pmap, rpa); ok {
 			log.Println(rp, rpa, bp)
 			fmap[bp] = vupdater(v, bp, fi.ModTime().Format(outputlayout))
 		} else {
@@ -205,6 +218,15 @@ func mapmaker(path, ext, pext string, pmap map[string]*Row, vupdater Updater) ma
 	return fmap
 }
 
+// lookup finds the row for the file name, or for it gzipped.
+func lookup(pmap map[string]*Row, name string) (*Row, bool) {
+	if v, ok := pmap[name]; ok {
+		return v, true
+	}
+	v, ok := pmap[name+".gz"]
+	return v, ok
+}
+
 func converter(f *Row) []string {
 	return []string{
 		f.Original,
@@ -0,0 +1,51 @@
+// Command sttstandin is a stand-in for a self-hosted speech recognizer
+// with an OpenAI style /v1/audio/transcriptions API. It checks requests
+// from transcribe -backend http and replies with a canned transcription
+// so that the http backend can be tried without a real recognizer.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+
+	"github.com/rjkroege/transcription/httpstt"
+)
+
+const helptext = `Usage: sttstandin [-addr <address>] [-reply <verbose json file>]
+
+sttstandin answers POST /v1/audio/transcriptions with the transcription
+in the -reply file or, without one, a transcription naming the posted
+audio file. The request must be multipart form data with a file and
+response_format=verbose_json.
+`
+
+var addr = flag.String("addr", "localhost:8000", "listen on this address")
+var replyfile = flag.String("reply", "", "reply with the verbose JSON transcription in this file")
+
+func main() {
+	flag.Usage = func() {
+		io.WriteString(os.Stderr, helptext)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	s := new(httpstt.Standin)
+	if *replyfile != "" {
+		buffy, err := ioutil.ReadFile(*replyfile)
+		if err != nil {
+			log.Fatalf("can't read reply: %v", err)
+		}
+		var tr httpstt.Transcription
+		if err := json.Unmarshal(buffy, &tr); err != nil {
+			log.Fatalf("bad reply %s: %v", *replyfile, err)
+		}
+		s.Reply = buffy
+	}
+	log.Printf("listening on %s", *addr)
+	log.Fatal(http.ListenAndServe(*addr, s))
+}
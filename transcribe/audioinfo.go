@@ -0,0 +1,187 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"golang.org/x/net/context"
+	speechpb "google.golang.org/genproto/googleapis/cloud/speech/v1p1beta1"
+)
+
+// audioinfo describes an audio file from its header.
+type audioinfo struct {
+	encoding   speechpb.RecognitionConfig_AudioEncoding
+	samplerate int
+	channels   int
+	duration   time.Duration
+
+	// Where the samples are in a WAV file.
+	dataoffset int64
+	datasize   int64
+}
+
+// headersize is enough of the start of an audio file to find its
+// format.
+const headersize = 64 << 10
+
+// readaudioinfo parses the header of a WAV or FLAC file. header is the
+// start of the file and size is the size of the whole file.
+func readaudioinfo(header []byte, size int64) (*audioinfo, error) {
+	switch {
+	case len(header) >= 12 && string(header[0:4]) == "RIFF" && string(header[8:12]) == "WAVE":
+		return readwavinfo(header, size)
+	case len(header) >= 4 && string(header[0:4]) == "fLaC":
+		return readflacinfo(header)
+	}
+	return nil, fmt.Errorf("not a WAV or FLAC file")
+}
+
+// readwavinfo parses the chunks of a RIFF WAVE header.
+func readwavinfo(header []byte, size int64) (*audioinfo, error) {
+	info := &audioinfo{}
+	byterate := 0
+	for off := 12; off+8 <= len(header); {
+		id := string(header[off : off+4])
+		chunksize := int64(binary.LittleEndian.Uint32(header[off+4 : off+8]))
+		body := header[off+8:]
+
+		switch id {
+		case "fmt ":
+			if len(body) < 16 {
+				return nil, fmt.Errorf("short WAV fmt chunk")
+			}
+			format := binary.LittleEndian.Uint16(body[0:2])
+			info.channels = int(binary.LittleEndian.Uint16(body[2:4]))
+			info.samplerate = int(binary.LittleEndian.Uint32(body[4:8]))
+			byterate = int(binary.LittleEndian.Uint32(body[8:12]))
+			bits := binary.LittleEndian.Uint16(body[14:16])
+			switch {
+			// 0xfffe is WAVE_FORMAT_EXTENSIBLE, which ffmpeg writes for
+			// more than two channels.
+			case (format == 1 || format == 0xfffe) && bits == 16:
+				info.encoding = speechpb.RecognitionConfig_LINEAR16
+			case format == 7:
+				info.encoding = speechpb.RecognitionConfig_MULAW
+			}
+		case "data":
+			if byterate == 0 {
+				return nil, fmt.Errorf("WAV data chunk before fmt chunk")
+			}
+			// Streamed WAVs don't know their length so trust the file size
+			// instead.
+			if remaining := size - int64(off+8); chunksize == 0xffffffff || chunksize > remaining {
+				chunksize = remaining
+			}
+			info.duration = time.Duration(chunksize) * time.Second / time.Duration(byterate)
+			info.dataoffset = int64(off + 8)
+			info.datasize = chunksize
+			return info, nil
+		}
+
+		// Chunks are padded to an even length.
+		off += 8 + int(chunksize) + int(chunksize&1)
+	}
+	return nil, fmt.Errorf("no WAV data chunk in the first %d bytes", len(header))
+}
+
+// readflacinfo parses the STREAMINFO block at the start of a FLAC file.
+func readflacinfo(header []byte) (*audioinfo, error) {
+	// fLaC, a 4 byte metadata block header and then STREAMINFO.
+	if len(header) < 4+4+18 || header[4]&0x7f != 0 {
+		return nil, fmt.Errorf("FLAC file doesn't start with STREAMINFO")
+	}
+	si := header[8:]
+
+	// 20 bits of sample rate, 3 bits of channels - 1, 5 bits of bits per
+	// sample - 1 and 36 bits of total samples.
+	packed := binary.BigEndian.Uint64(si[10:18])
+	rate := packed >> 44
+	channels := (packed>>41)&0x7 + 1
+	samples := packed & 0xfffffffff
+	if rate == 0 {
+		return nil, fmt.Errorf("FLAC sample rate is 0")
+	}
+	return &audioinfo{
+		encoding:   speechpb.RecognitionConfig_FLAC,
+		samplerate: int(rate),
+		channels:   int(channels),
+		duration:   time.Duration(samples) * time.Second / time.Duration(rate),
+	}, nil
+}
+
+// localaudioinfo reads the header of the local audio file fn.
+func localaudioinfo(fn string) (*audioinfo, error) {
+	fd, err := os.Open(fn)
+	if err != nil {
+		return nil, err
+	}
+	defer fd.Close()
+
+	fi, err := fd.Stat()
+	if err != nil {
+		return nil, err
+	}
+	header := new(bytes.Buffer)
+	if _, err := io.CopyN(header, fd, headersize); err != nil && err != io.EOF {
+		return nil, err
+	}
+	info, err := readaudioinfo(header.Bytes(), fi.Size())
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", fn, err)
+	}
+	return info, nil
+}
+
+// gcsaudioinfo reads the header of the audio object at gcsURI.
+func gcsaudioinfo(ctx context.Context, gcsURI string) (*audioinfo, error) {
+	bucket, name, err := splitgcsuri(gcsURI)
+	if err != nil {
+		return nil, err
+	}
+	client, err := storageclient(ctx)
+	if err != nil {
+		return nil, err
+	}
+	reader, err := client.Bucket(bucket).Object(name).NewRangeReader(ctx, 0, headersize)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", gcsURI, err)
+	}
+	defer reader.Close()
+	header := new(bytes.Buffer)
+	if _, err := io.Copy(header, reader); err != nil {
+		return nil, fmt.Errorf("%s: %v", gcsURI, err)
+	}
+	info, err := readaudioinfo(header.Bytes(), reader.Attrs.Size)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", gcsURI, err)
+	}
+	return info, nil
+}
+
+// maxchannels is the most channels that the API recognizes separately.
+const maxchannels = 8
+
+// jobaudioinfo reads the header of the audio of j.
+func jobaudioinfo(ctx context.Context, j *job) (*audioinfo, error) {
+	if j.localpath != "" {
+		return localaudioinfo(j.localpath)
+	}
+	return gcsaudioinfo(ctx, j.uri)
+}
+
+// setchannels sets the channel count of config from info if each
+// channel is to be recognized separately.
+func setchannels(config *speechpb.RecognitionConfig, info *audioinfo) error {
+	if !config.EnableSeparateRecognitionPerChannel {
+		return nil
+	}
+	if info.channels > maxchannels {
+		return fmt.Errorf("%d channels, the API recognizes at most %d separately", info.channels, maxchannels)
+	}
+	config.AudioChannelCount = int32(info.channels)
+	return nil
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+	"time"
+
+	speechpb "google.golang.org/genproto/googleapis/cloud/speech/v1p1beta1"
+)
+
+// makewav makes a silent 16 bit PCM WAV file.
+func makewav(rate, channels int, length time.Duration) []byte {
+	datasize := int(length/time.Millisecond) * rate / 1000 * channels * 2
+	b := new(bytes.Buffer)
+	b.WriteString("RIFF")
+	binary.Write(b, binary.LittleEndian, uint32(4+8+16+8+datasize))
+	b.WriteString("WAVE")
+
+	// A chunk that should be skipped.
+	b.WriteString("LIST")
+	binary.Write(b, binary.LittleEndian, uint32(3))
+	b.WriteString("abc\x00")
+
+	b.WriteString("fmt ")
+	binary.Write(b, binary.LittleEndian, uint32(16))
+	binary.Write(b, binary.LittleEndian, uint16(1))
+	binary.Write(b, binary.LittleEndian, uint16(channels))
+	binary.Write(b, binary.LittleEndian, uint32(rate))
+	binary.Write(b, binary.LittleEndian, uint32(rate*channels*2))
+	binary.Write(b, binary.LittleEndian, uint16(channels*2))
+	binary.Write(b, binary.LittleEndian, uint16(16))
+
+	b.WriteString("data")
+	binary.Write(b, binary.LittleEndian, uint32(datasize))
+	b.Write(make([]byte, datasize))
+	return b.Bytes()
+}
+
+// makeflacheader makes the start of a FLAC file.
+func makeflacheader(rate, channels int, samples uint64) []byte {
+	b := new(bytes.Buffer)
+	b.WriteString("fLaC")
+	b.Write([]byte{0x80, 0, 0, 34})
+	b.Write(make([]byte, 10))
+	binary.Write(b, binary.BigEndian, uint64(rate)<<44|uint64(channels-1)<<41|uint64(15)<<36|samples)
+	b.Write(make([]byte, 16))
+	return b.Bytes()
+}
+
+func TestReadaudioinfo(t *testing.T) {
+	wav := makewav(16000, 2, 1500*time.Millisecond)
+	flac := makeflacheader(44100, 1, 44100*90)
+
+	tt := []struct {
+		name   string
+		header []byte
+		size   int64
+		want   audioinfo
+		iserr  bool
+	}{
+		{"wav", wav, int64(len(wav)), audioinfo{encoding: speechpb.RecognitionConfig_LINEAR16, samplerate: 16000, channels: 2, duration: 1500 * time.Millisecond}, false},
+		// Only the header of a long file has been read.
+		{"wav header", wav[:200], int64(len(wav)), audioinfo{encoding: speechpb.RecognitionConfig_LINEAR16, samplerate: 16000, channels: 2, duration: 1500 * time.Millisecond}, false},
+		{"flac", flac, 1 << 20, audioinfo{encoding: speechpb.RecognitionConfig_FLAC, samplerate: 44100, channels: 1, duration: 90 * time.Second}, false},
+		{"mp3", []byte("ID3\x03\x00\x00\x00\x00\x00\x00"), 10, audioinfo{}, true},
+		{"truncated", wav[:30], int64(len(wav)), audioinfo{}, true},
+	}
+
+	for _, tv := range tt {
+		got, err := readaudioinfo(tv.header, tv.size)
+		if tv.iserr {
+			if err == nil {
+				t.Errorf("%s: no error, got %+v", tv.name, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", tv.name, err)
+			continue
+		}
+		if got.encoding != tv.want.encoding || got.samplerate != tv.want.samplerate ||
+			got.channels != tv.want.channels || got.duration != tv.want.duration {
+			t.Errorf("%s: got %+v, want %+v", tv.name, *got, tv.want)
+		}
+	}
+}
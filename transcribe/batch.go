@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"strings"
+	"sync"
+
+	"cloud.google.com/go/storage"
+	"github.com/gammazero/workerpool"
+	"golang.org/x/net/context"
+	"google.golang.org/api/iterator"
+)
+
+// readbatchlist reads the short names of the objects to transcribe from
+// the file at fn. Names are one per line. Blank lines and lines starting
+// with # are ignored.
+func readbatchlist(fn string) ([]string, error) {
+	fd, err := os.Open(fn)
+	if err != nil {
+		return nil, err
+	}
+	defer fd.Close()
+
+	names := make([]string, 0, 10)
+	scanner := bufio.NewScanner(fd)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		names = append(names, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return names, nil
+}
+
+// splitgcsuri splits a gs://bucket/some/path URI into the bucket and the
+// path within the bucket. The path has no leading or trailing /.
+func splitgcsuri(uri string) (string, string, error) {
+	if !strings.HasPrefix(uri, "gs://") {
+		return "", "", fmt.Errorf("%q is not a gs:// URI", uri)
+	}
+	parts := strings.SplitN(strings.TrimPrefix(uri, "gs://"), "/", 2)
+	if parts[0] == "" {
+		return "", "", fmt.Errorf("%q has no bucket", uri)
+	}
+	if len(parts) < 2 {
+		return parts[0], "", nil
+	}
+	return parts[0], strings.Trim(parts[1], "/"), nil
+}
+
+// globobjects lists the objects in the bucket path base and returns the
+// short names (relative to base) of those matching pattern.
+func globobjects(ctx context.Context, base, pattern string) ([]string, error) {
+	// Catch a malformed pattern before listing a possibly large bucket.
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, err
+	}
+
+	bucket, prefix, err := splitgcsuri(base)
+	if err != nil {
+		return nil, err
+	}
+	if prefix != "" {
+		prefix += "/"
+	}
+
+	client, err := storageclient(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, 10)
+	it := client.Bucket(bucket).Objects(ctx, &storage.Query{Prefix: prefix})
+	for {
+		attrs, err := it.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		shortname := strings.TrimPrefix(attrs.Name, prefix)
+		if ok, _ := path.Match(pattern, shortname); ok {
+			names = append(names, shortname)
+		}
+	}
+	return names, nil
+}
+
+// runbatch transcribes each of shorturis using the shared recognizer
+// rec with at most jobs transcriptions in flight at once. Returns the
+// exit status of the worst failure.
+func runbatch(ctx context.Context, rec recognizer, shorturis []string, jobs int) int {
+	if jobs < 1 {
+		jobs = 1
+	}
+	wp := workerpool.New(jobs)
+
+	var mu sync.Mutex
+	failed := 0
+	status := exitok
+	for _, s := range shorturis {
+		shorturi := s
+		wp.Submit(func() {
+			if err := dotranscribe(ctx, rec, shorturi); err != nil {
+				log.Printf("%s: transcription failed: %v", shorturi, err)
+				mu.Lock()
+				failed++
+				if s := exitstatus(err); s > status {
+					status = s
+				}
+				mu.Unlock()
+			}
+		})
+	}
+	wp.StopWait()
+
+	if failed > 0 {
+		log.Printf("%d of %d transcriptions failed", failed, len(shorturis))
+	}
+	return status
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestReadbatchlist(t *testing.T) {
+	dir, err := ioutil.TempDir("", "transcribe")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	fn := filepath.Join(dir, "list")
+	in := "# kids clips\nclip-1.wav\n\n  clip-2-<0>.wav  \nclip-2-<1>.wav\n"
+	if err := ioutil.WriteFile(fn, []byte(in), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := readbatchlist(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"clip-1.wav", "clip-2-<0>.wav", "clip-2-<1>.wav"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestSplitgcsuri(t *testing.T) {
+	tt := []struct {
+		input  string
+		bucket string
+		prefix string
+		iserr  bool
+	}{
+		{"gs://audioscratch", "audioscratch", "", false},
+		{"gs://audioscratch/", "audioscratch", "", false},
+		{"gs://audioscratch/kids/april/", "audioscratch", "kids/april", false},
+		{"/tmp/audioscratch", "", "", true},
+		{"gs:///nobucket", "", "", true},
+	}
+
+	for i, tv := range tt {
+		bucket, prefix, err := splitgcsuri(tv.input)
+		if got, want := err != nil, tv.iserr; got != want {
+			t.Errorf("%d: %s: error got %v, want %v", i, tv.input, err, want)
+		}
+		if bucket != tv.bucket || prefix != tv.prefix {
+			t.Errorf("%d: %s: got (%q, %q), want (%q, %q)", i, tv.input, bucket, prefix, tv.bucket, tv.prefix)
+		}
+	}
+}
+
+func TestRunbatch(t *testing.T) {
+	defer intempdir(t)()
+
+	f := newFakespeech()
+	slow := []fakestep{{progress: 10}, {progress: 50}, {progress: 90}, {resp: cannedresp}}
+	shorturis := []string{"a.wav", "b.wav", "c.wav", "d.wav", "done.wav", "bad.wav"}
+	for _, s := range shorturis {
+		f.scripts["gs://audioscratch/"+s] = slow
+	}
+	f.scripts["gs://audioscratch/bad.wav"] = []fakestep{{progress: 10}, {failure: status.New(codes.InvalidArgument, "bad audio")}}
+	rec, shutdown := newFakeRecognizer(t, f)
+	defer shutdown()
+
+	// done.wav was transcribed by an earlier run.
+	if err := ioutil.WriteFile("done-en-US.json", []byte("{}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := runbatch(context.Background(), rec, shorturis, 2), exitfailed; got != want {
+		t.Errorf("runbatch returned %d, want %d", got, want)
+	}
+	if got, want := len(f.submitted), 5; got != want {
+		t.Errorf("submitted %d requests, want %d", got, want)
+	}
+	for _, req := range f.submitted {
+		if req.GetAudio().GetUri() == "gs://audioscratch/done.wav" {
+			t.Error("submitted done.wav again")
+		}
+	}
+	if f.maxrunning > 2 {
+		t.Errorf("ran %d operations at once, want at most 2", f.maxrunning)
+	}
+	for _, s := range []string{"a", "b", "c", "d"} {
+		if got, want := readresult(t, s+"-en-US.json").Results[0].Alternatives[0].Transcript, "hello there"; got != want {
+			t.Errorf("%s: saved transcript %q, want %q", s, got, want)
+		}
+	}
+	if _, err := os.Stat("bad-en-US.json"); !os.IsNotExist(err) {
+		t.Errorf("saved a result for bad.wav: %v", err)
+	}
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"path/filepath"
+	"text/tabwriter"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// billingincrement is the unit that the API charges for. Each request
+// is rounded up to a whole number of them.
+const billingincrement = 15 * time.Second
+
+// price is what the API charges per minute of audio for a combination
+// of recognition features.
+type price struct {
+	Model       string  `json:"model"`
+	Enhanced    bool    `json:"enhanced"`
+	Diarization bool    `json:"diarization"`
+	PerMinute   float64 `json:"per_minute"`
+}
+
+// pricekey identifies the row of the price table used for a profile.
+type pricekey struct {
+	model       string
+	enhanced    bool
+	diarization bool
+}
+
+// pricetable maps recognition features to the price per minute.
+type pricetable map[pricekey]float64
+
+// builtinprices are the list prices in USD when this was written. Give
+// a -prices file to use current ones.
+var builtinprices = []price{
+	{Model: "default", PerMinute: 0.024},
+	{Model: "default", Diarization: true, PerMinute: 0.024},
+	{Model: "default", Enhanced: true, PerMinute: 0.024},
+	{Model: "default", Enhanced: true, Diarization: true, PerMinute: 0.024},
+	{Model: "command_and_search", PerMinute: 0.024},
+	{Model: "phone_call", PerMinute: 0.024},
+	{Model: "phone_call", Diarization: true, PerMinute: 0.024},
+	{Model: "phone_call", Enhanced: true, PerMinute: 0.036},
+	{Model: "phone_call", Enhanced: true, Diarization: true, PerMinute: 0.036},
+	{Model: "video", PerMinute: 0.036},
+	{Model: "video", Diarization: true, PerMinute: 0.036},
+	{Model: "video", Enhanced: true, PerMinute: 0.036},
+	{Model: "video", Enhanced: true, Diarization: true, PerMinute: 0.036},
+}
+
+// readprices reads the price table in the JSON file fn, a list of
+// prices. They are added to (and can replace) the built in ones.
+func readprices(fn string) (pricetable, error) {
+	rows := builtinprices
+	if fn != "" {
+		buffy, err := ioutil.ReadFile(fn)
+		if err != nil {
+			return nil, err
+		}
+		var fromfile []price
+		if err := json.Unmarshal(buffy, &fromfile); err != nil {
+			return nil, fmt.Errorf("%s: %v", fn, err)
+		}
+		for i, p := range fromfile {
+			if p.PerMinute < 0 {
+				return nil, fmt.Errorf("%s: price %d: per_minute is negative", fn, i)
+			}
+		}
+		rows = append(append([]price(nil), rows...), fromfile...)
+	}
+
+	prices := make(pricetable, len(rows))
+	for _, p := range rows {
+		prices[priceof(p.Model, p.Enhanced, p.Diarization)] = p.PerMinute
+	}
+	return prices, nil
+}
+
+// priceof makes the key for a combination of features. The API's
+// default model has no name.
+func priceof(model string, enhanced, diarization bool) pricekey {
+	if model == "" {
+		model = "default"
+	}
+	return pricekey{model: model, enhanced: enhanced, diarization: diarization}
+}
+
+// cost estimates what transcribing d of audio with channels channels
+// with profile p costs. Each channel is billed when they are recognized
+// separately.
+func (pt pricetable) cost(p *profile, d time.Duration, channels int) (float64, error) {
+	key := priceof(p.Model, p.UseEnhanced, p.Diarization)
+	perminute, ok := pt[key]
+	if !ok {
+		return 0, fmt.Errorf("no price for model %s with enhanced %v and diarization %v", key.model, key.enhanced, key.diarization)
+	}
+	increments := (d + billingincrement - 1) / billingincrement
+	if !p.SeparateChannels || channels < 1 {
+		channels = 1
+	}
+	return float64(channels) * float64(increments) * perminute * billingincrement.Minutes(), nil
+}
+
+// estimate is the expected cost of one transcription.
+type estimate struct {
+	shorturi string
+	duration time.Duration
+	channels int
+	cost     float64
+	err      error
+}
+
+// audioduration finds how long the audio that would be transcribed for
+// shorturi is and how many channels it has by reading its header.
+func audioduration(ctx context.Context, shorturi string) (time.Duration, int, error) {
+	var info *audioinfo
+	var err error
+	if islocalaudio(shorturi) {
+		info, err = localaudioinfo(shorturi)
+	} else {
+		info, err = gcsaudioinfo(ctx, *uribase+"/"+shorturi)
+	}
+	if err != nil {
+		return 0, 0, err
+	}
+	return info.duration, info.channels, nil
+}
+
+// estimatebatch estimates the cost of transcribing each of shorturis
+// with profile p. Audio already transcribed or submitted is left out
+// because it won't be submitted again.
+func estimatebatch(ctx context.Context, shorturis []string, prices pricetable, p *profile) []*estimate {
+	estimates := make([]*estimate, 0, len(shorturis))
+	for _, shorturi := range shorturis {
+		name := shorturi
+		if islocalaudio(name) {
+			name = filepath.Base(name)
+		}
+		outputfile := outputname(name)
+		if resultexists(ctx, outputfile) != "" || pending.lookup(outputfile) != nil {
+			continue
+		}
+
+		e := &estimate{shorturi: shorturi}
+		e.duration, e.channels, e.err = audioduration(ctx, shorturi)
+		if e.err == nil {
+			e.cost, e.err = prices.cost(p, e.duration, e.channels)
+		}
+		estimates = append(estimates, e)
+	}
+	return estimates
+}
+
+// writeestimates prints the estimate for each file and their total.
+func writeestimates(w io.Writer, estimates []*estimate) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', tabwriter.AlignRight)
+	total := 0.0
+	var length time.Duration
+	for _, e := range estimates {
+		if e.err != nil {
+			fmt.Fprintf(tw, "%s\t?\t?\t  %v\n", e.shorturi, e.err)
+			continue
+		}
+		fmt.Fprintf(tw, "%s\t%v\t$%.2f\t\n", e.shorturi, e.duration.Round(time.Second), e.cost)
+		total += e.cost
+		length += e.duration
+	}
+	fmt.Fprintf(tw, "total\t%v\t$%.2f\t\n", length.Round(time.Second), total)
+	return tw.Flush()
+}
+
+// overbudget returns the audio to refuse because the estimated cost of
+// transcribing it in order goes over budget, and audio whose cost can't
+// be estimated.
+func overbudget(estimates []*estimate, budget float64) map[string]bool {
+	refused := make(map[string]bool)
+	total := 0.0
+	over := false
+	for _, e := range estimates {
+		switch {
+		case e.err != nil:
+			log.Printf("%s: refusing to submit, can't estimate its cost: %v", e.shorturi, e.err)
+			refused[e.shorturi] = true
+		case over || total+e.cost > budget:
+			log.Printf("%s: refusing to submit, $%.2f would take the estimate to $%.2f, over the budget of $%.2f", e.shorturi, e.cost, total+e.cost, budget)
+			over = true
+			refused[e.shorturi] = true
+		default:
+			total += e.cost
+		}
+	}
+	log.Printf("estimated cost of the submitted audio is $%.2f", total)
+	return refused
+}
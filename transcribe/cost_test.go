@@ -0,0 +1,153 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"math"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+func TestReadprices(t *testing.T) {
+	defer intempdir(t)()
+
+	fn := filepath.Join(".", "prices.json")
+	in := `[{"model": "video", "enhanced": true, "diarization": true, "per_minute": 0.05},
+		{"model": "medical", "per_minute": 0.1}]`
+	if err := ioutil.WriteFile(fn, []byte(in), 0644); err != nil {
+		t.Fatal(err)
+	}
+	prices, err := readprices(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tt := []struct {
+		prof     *profile
+		d        time.Duration
+		channels int
+		want     float64
+		iserr    bool
+	}{
+		{builtinprofiles["default"], time.Minute, 1, 0.024, false},
+		// Billed in 15 second increments.
+		{builtinprofiles["default"], 61 * time.Second, 1, 0.03, false},
+		{builtinprofiles["diarize"], 2 * time.Minute, 1, 0.048, false},
+		{builtinprofiles["video"], time.Minute, 1, 0.05, false},
+		{&profile{Model: "medical"}, 30 * time.Second, 1, 0.05, false},
+		{&profile{Model: "medical", UseEnhanced: true}, time.Minute, 1, 0, true},
+		// Each channel is billed when they are recognized separately.
+		{builtinprofiles["channels"], time.Minute, 4, 0.096, false},
+		{builtinprofiles["default"], time.Minute, 4, 0.024, false},
+	}
+	for _, tv := range tt {
+		got, err := prices.cost(tv.prof, tv.d, tv.channels)
+		if (err != nil) != tv.iserr {
+			t.Errorf("%+v for %v: got error %v, want error %v", tv.prof, tv.d, err, tv.iserr)
+		}
+		if math.Abs(got-tv.want) > 1e-9 {
+			t.Errorf("%+v for %v: got $%v, want $%v", tv.prof, tv.d, got, tv.want)
+		}
+	}
+
+	if err := ioutil.WriteFile(fn, []byte(`[{"model": "video", "per_minute": -1}]`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := readprices(fn); err == nil {
+		t.Error("readprices accepted a negative price")
+	}
+}
+
+func TestEstimatebatch(t *testing.T) {
+	defer intempdir(t)()
+	f, shutdown := usefakegcs(t)
+	defer shutdown()
+
+	f.put("audioscratch", "long.wav", makewav(8000, 1, 2*time.Minute))
+	f.put("audioscratch", "garbage.wav", []byte("not audio"))
+	if err := ioutil.WriteFile("short.flac", makeflacheader(16000, 1, 16000*20), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// Results from before languages were in their names are done too.
+	for _, fn := range []string{"done-en-US.json", "olddone.json"} {
+		if err := ioutil.WriteFile(fn, []byte("{}"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := pending.add(&pendingop{Name: "operations/earlier", URI: "gs://audioscratch/submitted.wav", Output: "submitted-en-US.json"}); err != nil {
+		t.Fatal(err)
+	}
+
+	prices, err := readprices("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	shorturis := []string{"long.wav", "done.wav", "olddone.wav", "short.flac", "submitted.wav", "garbage.wav", "missing.wav"}
+	estimates := estimatebatch(context.Background(), shorturis, prices, builtinprofiles["default"])
+
+	want := []struct {
+		shorturi string
+		duration time.Duration
+		cost     float64
+		iserr    bool
+	}{
+		{"long.wav", 2 * time.Minute, 0.048, false},
+		{"short.flac", 20 * time.Second, 0.012, false},
+		{"garbage.wav", 0, 0, true},
+		{"missing.wav", 0, 0, true},
+	}
+	if len(estimates) != len(want) {
+		t.Fatalf("got %d estimates, want %d", len(estimates), len(want))
+	}
+	for i, w := range want {
+		e := estimates[i]
+		if e.shorturi != w.shorturi || e.duration != w.duration || math.Abs(e.cost-w.cost) > 1e-9 || (e.err != nil) != w.iserr {
+			t.Errorf("%d: got %s %v $%v (%v), want %s %v $%v", i, e.shorturi, e.duration, e.cost, e.err, w.shorturi, w.duration, w.cost)
+		}
+	}
+
+	buffy := new(bytes.Buffer)
+	if err := writeestimates(buffy, estimates); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := buffy.String(), "total  2m20s  $0.06"; !strings.Contains(got, want) {
+		t.Errorf("estimates %q don't contain %q", got, want)
+	}
+
+	refused := overbudget(estimates, 0.05)
+	for _, s := range []string{"short.flac", "garbage.wav", "missing.wav"} {
+		if !refused[s] {
+			t.Errorf("%s wasn't refused", s)
+		}
+	}
+	if refused["long.wav"] {
+		t.Error("long.wav was refused")
+	}
+}
+
+func TestEstimatebatchChannels(t *testing.T) {
+	defer intempdir(t)()
+	if err := ioutil.WriteFile("mics.wav", makewav(8000, 4, time.Minute), 0644); err != nil {
+		t.Fatal(err)
+	}
+	prices, err := readprices("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Recognizing the 4 microphones separately bills each of them.
+	estimates := estimatebatch(context.Background(), []string{"mics.wav"}, prices, builtinprofiles["channels"])
+	if len(estimates) != 1 || estimates[0].err != nil {
+		t.Fatalf("got estimates %v", estimates)
+	}
+	if got, want := estimates[0].cost, 0.096; math.Abs(got-want) > 1e-9 {
+		t.Errorf("got $%v, want $%v", got, want)
+	}
+	if refused := overbudget(estimates, 0.05); !refused["mics.wav"] {
+		t.Error("mics.wav wasn't refused")
+	}
+}
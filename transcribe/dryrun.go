@@ -0,0 +1,123 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/golang/protobuf/proto"
+	"golang.org/x/net/context"
+	speechpb "google.golang.org/genproto/googleapis/cloud/speech/v1p1beta1"
+)
+
+// Sample rates accepted by the API.
+const (
+	minsamplerate = 8000
+	maxsamplerate = 48000
+)
+
+var (
+	dryrunmu  sync.Mutex
+	dryrunout io.Writer = os.Stdout
+)
+
+// writedryrun prints the report of a dry run of one job in one piece so
+// that concurrent jobs don't interleave.
+func writedryrun(report []byte) {
+	dryrunmu.Lock()
+	defer dryrunmu.Unlock()
+	dryrunout.Write(report)
+}
+
+// checkaudio returns what would stop the API from transcribing audio
+// described by info with method. Each warning is something that would
+// make the transcription worse.
+func checkaudio(info *audioinfo, method string, config *speechpb.RecognitionConfig) (problems, warnings []string) {
+	switch {
+	case info.encoding == speechpb.RecognitionConfig_ENCODING_UNSPECIFIED:
+		problems = append(problems, "unsupported encoding, use 16 bit PCM WAV or FLAC")
+	case method == methodstreaming && info.encoding != speechpb.RecognitionConfig_LINEAR16:
+		problems = append(problems, fmt.Sprintf("can't stream %v audio, only LINEAR16", info.encoding))
+	}
+	if info.samplerate < minsamplerate || info.samplerate > maxsamplerate {
+		problems = append(problems, fmt.Sprintf("sample rate %d Hz is not between %d and %d", info.samplerate, minsamplerate, maxsamplerate))
+	}
+	if info.channels < 1 {
+		problems = append(problems, "no channels")
+	}
+	if info.channels > 1 && !config.EnableSeparateRecognitionPerChannel {
+		warnings = append(warnings, fmt.Sprintf("%d channels but only the first will be transcribed", info.channels))
+	}
+	if info.duration == 0 {
+		warnings = append(warnings, "no audio")
+	}
+	return problems, warnings
+}
+
+// dryrunjob checks that the audio of j can be read and transcribed and
+// prints the request that would be made with config and where the
+// result would go. Nothing is uploaded or submitted.
+func dryrunjob(ctx context.Context, j *job, method string, config *speechpb.RecognitionConfig) error {
+	report := new(bytes.Buffer)
+	fmt.Fprintf(report, "%s:\n", j.uri)
+
+	if j.localpath != "" {
+		fmt.Fprintf(report, "  local audio: %s\n", j.localpath)
+		if method == methodlongrunning {
+			fmt.Fprintf(report, "  would upload to: %s\n", j.uri)
+		}
+	}
+	info, err := jobaudioinfo(ctx, j)
+	if err != nil {
+		fmt.Fprintf(report, "  can't read audio: %v\n\n", err)
+		writedryrun(report.Bytes())
+		return err
+	}
+	fmt.Fprintf(report, "  audio: %v, %d Hz, %d channels, %v\n", info.encoding, info.samplerate, info.channels, info.duration)
+	problems, warnings := checkaudio(info, method, config)
+	if err := setchannels(config, info); err != nil {
+		problems = append(problems, err.Error())
+	}
+	for _, p := range problems {
+		fmt.Fprintf(report, "  problem: %s\n", p)
+	}
+	for _, w := range warnings {
+		fmt.Fprintf(report, "  warning: %s\n", w)
+	}
+
+	// The request as it would be sent. Inline and streamed audio is sent
+	// in pieces so only the config is shown.
+	var req proto.Message = buildrequest(config, j.uri)
+	if method != methodlongrunning {
+		req = config
+	}
+	fmt.Fprintf(report, "  method: %s\n", method)
+	marshaler := &jsonpb.Marshaler{Indent: "  "}
+	js, err := marshaler.MarshalToString(req)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(report, "  request: %s\n", bytes.Replace([]byte(js), []byte("\n"), []byte("\n  "), -1))
+	fmt.Fprintf(report, "  output: %s\n", j.outputfile)
+	fmt.Fprintf(report, "  provenance: %s\n", metaname(j.outputfile))
+	if *outprefix != "" {
+		fmt.Fprintf(report, "  would copy output to: %s\n", resulturi(j.outputfile))
+	}
+	switch {
+	case method != methodlongrunning:
+	case *archiveprefix != "":
+		fmt.Fprintf(report, "  would archive audio under: %s\n", *archiveprefix)
+	case *deleteaudio:
+		fmt.Fprintf(report, "  would delete audio: %s\n", j.uri)
+	}
+	fmt.Fprintln(report)
+	writedryrun(report.Bytes())
+
+	if len(problems) > 0 {
+		return fmt.Errorf("%s: %s", j.uri, problems[0])
+	}
+	return nil
+}
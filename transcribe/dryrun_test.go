@@ -0,0 +1,65 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+func TestDryrun(t *testing.T) {
+	defer intempdir(t)()
+	g, shutdowngcs := usefakegcs(t)
+	defer shutdowngcs()
+
+	olddryrun, oldout := *dryrun, dryrunout
+	report := new(bytes.Buffer)
+	*dryrun, dryrunout = true, report
+	defer func() { *dryrun, dryrunout = olddryrun, oldout }()
+
+	g.put("audioscratch", "stereo.wav", makewav(44100, 2, 3*time.Minute))
+	g.put("audioscratch", "slow.wav", makewav(4000, 1, time.Minute))
+	if err := ioutil.WriteFile("short.wav", makewav(16000, 1, 10*time.Second), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tt := []struct {
+		shorturi string
+		iserr    bool
+		want     []string
+	}{
+		{"stereo.wav", false, []string{
+			"audio: LINEAR16, 44100 Hz, 2 channels, 3m0s",
+			"warning: 2 channels but only the first will be transcribed",
+			"method: longrunning",
+			`"uri": "gs://audioscratch/stereo.wav"`,
+			`"languageCode": "en-US"`,
+			"output: stereo-en-US.json",
+		}},
+		{"slow.wav", true, []string{"problem: sample rate 4000 Hz is not between 8000 and 48000"}},
+		{"missing.wav", true, []string{"can't read audio"}},
+		{"short.wav", false, []string{"local audio: short.wav", "method: inline", "output: short-en-US.json"}},
+	}
+	for _, tv := range tt {
+		report.Reset()
+		err := dotranscribe(context.Background(), nil, tv.shorturi)
+		if (err != nil) != tv.iserr {
+			t.Errorf("%s: got error %v, want error %v", tv.shorturi, err, tv.iserr)
+		}
+		for _, w := range tv.want {
+			if !strings.Contains(report.String(), w) {
+				t.Errorf("%s: report %s doesn't contain %q", tv.shorturi, report, w)
+			}
+		}
+		if _, err := os.Stat(outputname(tv.shorturi)); !os.IsNotExist(err) {
+			t.Errorf("%s: dry run wrote a result", tv.shorturi)
+		}
+	}
+	if g.get("audioscratch", "short.wav") != nil {
+		t.Error("dry run uploaded audio")
+	}
+}
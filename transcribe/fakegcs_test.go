@@ -0,0 +1,322 @@
+package main
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeobject is an object stored in the fake GCS server.
+type fakeobject struct {
+	contenttype string
+	data        []byte
+}
+
+// fakegcs is a local stand-in for the parts of the GCS JSON and XML APIs
+// that transcribe uses. Objects are keyed by bucket/name.
+type fakegcs struct {
+	mu        sync.Mutex
+	objects   map[string]*fakeobject
+	sessions  map[string]*fakeobject // Resumable uploads in progress.
+	uploads   int                    // Completed uploads.
+	resumable int                    // Completed uploads that used sessions.
+	copies    int                    // Objects copied within GCS.
+}
+
+// usefakegcs starts a fake GCS server and points transcribe's storage
+// client at it. Call the returned function to shut it down.
+func usefakegcs(t *testing.T) (*fakegcs, func()) {
+	f := &fakegcs{
+		objects:  make(map[string]*fakeobject),
+		sessions: make(map[string]*fakeobject),
+	}
+	srv := httptest.NewServer(f)
+
+	oldendpoint := *storageendpoint
+	*storageendpoint = srv.URL
+	gcs = nil
+
+	return f, func() {
+		if gcs != nil {
+			gcs.Close()
+		}
+		gcs = nil
+		*storageendpoint = oldendpoint
+		srv.Close()
+	}
+}
+
+// put stores data as bucket/name.
+func (f *fakegcs) put(bucket, name string, data []byte) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.objects[bucket+"/"+name] = &fakeobject{data: data}
+}
+
+// get returns the contents of bucket/name or nil if there is no such
+// object.
+func (f *fakegcs) get(bucket, name string) []byte {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if o, ok := f.objects[bucket+"/"+name]; ok {
+		return o.data
+	}
+	return nil
+}
+
+func (f *fakegcs) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	p := r.URL.Path
+	switch {
+	case strings.HasPrefix(p, "/upload/storage/v1/b/"):
+		f.upload(w, r, strings.TrimSuffix(strings.TrimPrefix(p, "/upload/storage/v1/b/"), "/o"))
+	case strings.HasPrefix(p, "/storage/v1/b/"):
+		f.jsonapi(w, r, strings.TrimPrefix(p, "/storage/v1/b/"))
+	default:
+		f.download(w, r, strings.TrimPrefix(p, "/"))
+	}
+}
+
+// jsonapi serves object metadata requests. rest is bucket/o[/name].
+func (f *fakegcs) jsonapi(w http.ResponseWriter, r *http.Request, rest string) {
+	parts := strings.SplitN(rest, "/", 3)
+	if len(parts) < 2 || parts[1] != "o" {
+		http.Error(w, "fakegcs: unsupported request "+r.URL.Path, http.StatusNotImplemented)
+		return
+	}
+	bucket := parts[0]
+
+	if len(parts) == 2 {
+		// List the objects in bucket.
+		prefix := r.URL.Query().Get("prefix")
+		names := make([]string, 0)
+		for k := range f.objects {
+			if strings.HasPrefix(k, bucket+"/"+prefix) {
+				names = append(names, strings.TrimPrefix(k, bucket+"/"))
+			}
+		}
+		sort.Strings(names)
+		items := make([]map[string]string, 0, len(names))
+		for _, n := range names {
+			items = append(items, f.resource(bucket, n))
+		}
+		writejson(w, map[string]interface{}{"kind": "storage#objects", "items": items})
+		return
+	}
+
+	name := parts[2]
+	if i := strings.Index(name, "/rewriteTo/b/"); i >= 0 && r.Method == "POST" {
+		f.rewrite(w, bucket, name[:i], name[i+len("/rewriteTo/b/"):])
+		return
+	}
+	if _, ok := f.objects[bucket+"/"+name]; !ok {
+		http.Error(w, "fakegcs: no such object", http.StatusNotFound)
+		return
+	}
+	switch r.Method {
+	case "GET":
+		writejson(w, f.resource(bucket, name))
+	case "DELETE":
+		delete(f.objects, bucket+"/"+name)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "fakegcs: unsupported method "+r.Method, http.StatusNotImplemented)
+	}
+}
+
+// rewrite copies bucket/name to dest, which is dbucket/o/dname, in one
+// step.
+func (f *fakegcs) rewrite(w http.ResponseWriter, bucket, name, dest string) {
+	o, ok := f.objects[bucket+"/"+name]
+	parts := strings.SplitN(dest, "/", 3)
+	switch {
+	case !ok:
+		http.Error(w, "fakegcs: no such object", http.StatusNotFound)
+		return
+	case len(parts) != 3 || parts[1] != "o":
+		http.Error(w, "fakegcs: bad destination "+dest, http.StatusBadRequest)
+		return
+	}
+	nobj := *o
+	f.objects[parts[0]+"/"+parts[2]] = &nobj
+	f.copies++
+	writejson(w, map[string]interface{}{
+		"kind":                "storage#rewriteResponse",
+		"totalBytesRewritten": strconv.Itoa(len(o.data)),
+		"objectSize":          strconv.Itoa(len(o.data)),
+		"done":                true,
+		"resource":            f.resource(parts[0], parts[2]),
+	})
+}
+
+// upload handles multipart and resumable uploads to bucket.
+func (f *fakegcs) upload(w http.ResponseWriter, r *http.Request, bucket string) {
+	q := r.URL.Query()
+	switch {
+	case q.Get("uploadType") == "multipart":
+		mt, params, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		if err != nil || !strings.HasPrefix(mt, "multipart/") {
+			http.Error(w, "fakegcs: bad multipart upload", http.StatusBadRequest)
+			return
+		}
+		mr := multipart.NewReader(r.Body, params["boundary"])
+		metapart, err := mr.NextPart()
+		if err != nil {
+			http.Error(w, "fakegcs: no metadata part", http.StatusBadRequest)
+			return
+		}
+		meta, err := ioutil.ReadAll(metapart)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		datapart, err := mr.NextPart()
+		if err != nil {
+			http.Error(w, "fakegcs: no data part", http.StatusBadRequest)
+			return
+		}
+		data, err := ioutil.ReadAll(datapart)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		f.finishupload(w, bucket, meta, data, false)
+
+	case q.Get("uploadType") == "resumable" && q.Get("upload_id") == "":
+		meta, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		id := strconv.Itoa(len(f.sessions) + 1)
+		f.sessions[id] = &fakeobject{contenttype: string(meta)}
+		w.Header().Set("Location", fmt.Sprintf("http://%s/upload/storage/v1/b/%s/o?uploadType=resumable&upload_id=%s", r.Host, bucket, id))
+		w.WriteHeader(http.StatusOK)
+
+	case q.Get("upload_id") != "":
+		session, ok := f.sessions[q.Get("upload_id")]
+		if !ok {
+			http.Error(w, "fakegcs: no such upload", http.StatusNotFound)
+			return
+		}
+		data, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		session.data = append(session.data, data...)
+
+		// Content-Range is bytes first-last/total or bytes first-last/* if
+		// more is coming.
+		if strings.HasSuffix(r.Header.Get("Content-Range"), "/*") {
+			w.Header().Set("X-Http-Status-Code-Override", "308")
+			w.Header().Set("Range", fmt.Sprintf("bytes=0-%d", len(session.data)-1))
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		delete(f.sessions, q.Get("upload_id"))
+		f.finishupload(w, bucket, []byte(session.contenttype), session.data, true)
+
+	default:
+		http.Error(w, "fakegcs: unsupported upload "+r.URL.String(), http.StatusNotImplemented)
+	}
+}
+
+// finishupload stores the uploaded data after checking it against the
+// MD5 checksum in the metadata.
+func (f *fakegcs) finishupload(w http.ResponseWriter, bucket string, meta, data []byte, resumable bool) {
+	var attrs struct {
+		Name        string `json:"name"`
+		ContentType string `json:"contentType"`
+		MD5Hash     string `json:"md5Hash"`
+	}
+	if err := json.Unmarshal(meta, &attrs); err != nil {
+		http.Error(w, "fakegcs: bad metadata: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	sum := md5.Sum(data)
+	if attrs.MD5Hash != "" && attrs.MD5Hash != base64.StdEncoding.EncodeToString(sum[:]) {
+		http.Error(w, "fakegcs: MD5 mismatch", http.StatusBadRequest)
+		return
+	}
+
+	f.objects[bucket+"/"+attrs.Name] = &fakeobject{contenttype: attrs.ContentType, data: data}
+	f.uploads++
+	if resumable {
+		f.resumable++
+	}
+	writejson(w, f.resource(bucket, attrs.Name))
+}
+
+// download serves object contents. rest is bucket/name.
+func (f *fakegcs) download(w http.ResponseWriter, r *http.Request, rest string) {
+	o, ok := f.objects[rest]
+	if !ok {
+		http.Error(w, "fakegcs: no such object", http.StatusNotFound)
+		return
+	}
+
+	data := o.data
+	rng := r.Header.Get("Range")
+	if rng == "" {
+		w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+		w.WriteHeader(http.StatusOK)
+		w.Write(data)
+		return
+	}
+
+	var first, last int
+	if n, _ := fmt.Sscanf(rng, "bytes=%d-%d", &first, &last); n < 1 {
+		http.Error(w, "fakegcs: bad range "+rng, http.StatusBadRequest)
+		return
+	} else if n == 1 || last >= len(data) {
+		last = len(data) - 1
+	}
+	if first > last {
+		http.Error(w, "fakegcs: unsatisfiable range "+rng, http.StatusRequestedRangeNotSatisfiable)
+		return
+	}
+	w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", first, last, len(data)))
+	w.Header().Set("Content-Length", strconv.Itoa(last-first+1))
+	w.WriteHeader(http.StatusPartialContent)
+	w.Write(data[first : last+1])
+}
+
+// resource makes the JSON API description of bucket/name.
+func (f *fakegcs) resource(bucket, name string) map[string]string {
+	o := f.objects[bucket+"/"+name]
+	sum := md5.Sum(o.data)
+	return map[string]string{
+		"kind":        "storage#object",
+		"bucket":      bucket,
+		"name":        name,
+		"contentType": o.contenttype,
+		"size":        strconv.Itoa(len(o.data)),
+		"md5Hash":     base64.StdEncoding.EncodeToString(sum[:]),
+		"generation":  "1",
+	}
+}
+
+func writejson(w http.ResponseWriter, v interface{}) {
+	buffy := new(bytes.Buffer)
+	if err := json.NewEncoder(buffy).Encode(v); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(buffy.Bytes())
+}
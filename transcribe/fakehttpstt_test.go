@@ -0,0 +1,20 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/rjkroege/transcription/httpstt"
+)
+
+// usefakehttpstt starts the stand-in recognizer replying with reply, or
+// its canned transcription if reply is empty, and returns an
+// httprecognizer using it. Call the returned function to shut it down.
+func usefakehttpstt(t *testing.T, reply string) (*httpstt.Standin, *httprecognizer, func()) {
+	f := new(httpstt.Standin)
+	if reply != "" {
+		f.Reply = []byte(reply)
+	}
+	srv := httptest.NewServer(f)
+	return f, newHTTPRecognizer(srv.URL+httpstt.Path, "tiny", "sekrit"), srv.Close
+}
@@ -0,0 +1,252 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes"
+	"github.com/golang/protobuf/ptypes/duration"
+	"github.com/golang/protobuf/ptypes/empty"
+	"golang.org/x/net/context"
+	"google.golang.org/api/option"
+	speechpb "google.golang.org/genproto/googleapis/cloud/speech/v1p1beta1"
+	lropb "google.golang.org/genproto/googleapis/longrunning"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// fakestep is the canned reply to one poll of a fake operation.
+type fakestep struct {
+	progress int32                                  // Percent complete while in progress.
+	resp     *speechpb.LongRunningRecognizeResponse // Finish successfully with this.
+	failure  *status.Status                         // Finish unsuccessfully with this.
+	pollerr  codes.Code                             // Fail the poll itself with this.
+}
+
+// fakeop is an operation in the fake server. Each poll consumes one
+// step. The last step repeats forever.
+type fakeop struct {
+	steps []fakestep
+	polls int
+	done  bool
+}
+
+// fakespeech is an in-process Speech API that replays canned
+// LongRunningRecognizeResponse values. It serves both the Speech and the
+// long running Operations APIs.
+type fakespeech struct {
+	mu         sync.Mutex
+	scripts    map[string][]fakestep // Steps for each audio URI when submitted.
+	ops        map[string]*fakeop
+	submitted  []*speechpb.LongRunningRecognizeRequest
+	running    int // Operations submitted and not yet done.
+	maxrunning int // The most operations running at once.
+
+	inline     *speechpb.RecognizeResponse // Reply to every Recognize.
+	recognized []*speechpb.RecognizeRequest
+
+	streamed []int // Bytes of audio received on each stream.
+}
+
+func newFakespeech() *fakespeech {
+	return &fakespeech{
+		scripts: make(map[string][]fakestep),
+		ops:     make(map[string]*fakeop),
+	}
+}
+
+// newFakeRecognizer starts f on an in-memory listener and returns a
+// recognizer connected to it. Call the returned function to shut
+// everything down.
+func newFakeRecognizer(t *testing.T, f *fakespeech) (recognizer, func()) {
+	lis := bufconn.Listen(1 << 20)
+	server := grpc.NewServer()
+	speechpb.RegisterSpeechServer(server, f)
+	lropb.RegisterOperationsServer(server, f)
+	go server.Serve(lis)
+
+	conn, err := grpc.Dial("bufconn", grpc.WithInsecure(), grpc.WithDialer(func(string, time.Duration) (net.Conn, error) {
+		return lis.Dial()
+	}))
+	if err != nil {
+		t.Fatalf("can't dial fake speech server: %v", err)
+	}
+	rec, err := newGoogleRecognizer(context.Background(), option.WithGRPCConn(conn))
+	if err != nil {
+		t.Fatalf("can't make recognizer for fake speech server: %v", err)
+	}
+	return rec, func() {
+		rec.Close()
+		server.Stop()
+	}
+}
+
+// addop makes an already submitted operation called name.
+func (f *fakespeech) addop(name string, steps ...fakestep) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.ops[name] = &fakeop{steps: steps}
+	f.running++
+}
+
+func (f *fakespeech) Recognize(ctx context.Context, req *speechpb.RecognizeRequest) (*speechpb.RecognizeResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if len(req.GetAudio().GetContent()) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "fakespeech: no inline audio")
+	}
+	if f.inline == nil {
+		return nil, status.Error(codes.Unimplemented, "fakespeech: Recognize")
+	}
+	f.recognized = append(f.recognized, req)
+	return f.inline, nil
+}
+
+func (f *fakespeech) LongRunningRecognize(ctx context.Context, req *speechpb.LongRunningRecognizeRequest) (*lropb.Operation, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	uri := req.GetAudio().GetUri()
+	steps, ok := f.scripts[uri]
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "fakespeech: no such audio %q", uri)
+	}
+	f.submitted = append(f.submitted, req)
+	name := fmt.Sprintf("operations/%d", len(f.submitted))
+	f.ops[name] = &fakeop{steps: steps}
+	f.running++
+	if f.running > f.maxrunning {
+		f.maxrunning = f.running
+	}
+	return &lropb.Operation{Name: name}, nil
+}
+
+// StreamingRecognize replies to each piece of audio with an interim
+// result and ends the stream with a final result containing a single
+// word from 1s to 2s into the stream. With diarization, another final
+// result repeats the word said by speaker 1.
+func (f *fakespeech) StreamingRecognize(stream speechpb.Speech_StreamingRecognizeServer) error {
+	req, err := stream.Recv()
+	if err != nil {
+		return err
+	}
+	if req.GetStreamingConfig() == nil {
+		return status.Error(codes.InvalidArgument, "fakespeech: stream didn't start with a config")
+	}
+	diarize := req.GetStreamingConfig().GetConfig().GetEnableSpeakerDiarization()
+
+	f.mu.Lock()
+	n := len(f.streamed)
+	f.streamed = append(f.streamed, 0)
+	f.mu.Unlock()
+
+	for chunk := 0; ; chunk++ {
+		req, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		f.mu.Lock()
+		f.streamed[n] += len(req.GetAudioContent())
+		f.mu.Unlock()
+
+		if err := stream.Send(&speechpb.StreamingRecognizeResponse{
+			Results: []*speechpb.StreamingRecognitionResult{{
+				Alternatives: []*speechpb.SpeechRecognitionAlternative{{
+					Transcript: fmt.Sprintf("stream %d chunk %d", n, chunk),
+				}},
+			}},
+		}); err != nil {
+			return err
+		}
+	}
+
+	final := &speechpb.StreamingRecognitionResult{
+		IsFinal:       true,
+		ResultEndTime: &duration.Duration{Seconds: 2},
+		Alternatives: []*speechpb.SpeechRecognitionAlternative{{
+			Transcript: fmt.Sprintf("stream %d", n),
+			Words: []*speechpb.WordInfo{{
+				Word:      fmt.Sprintf("stream%d", n),
+				StartTime: &duration.Duration{Seconds: 1},
+				EndTime:   &duration.Duration{Seconds: 2},
+			}},
+		}},
+	}
+	results := []*speechpb.StreamingRecognitionResult{final}
+	if diarize {
+		speakers := proto.Clone(final).(*speechpb.StreamingRecognitionResult)
+		speakers.Alternatives[0].Transcript = ""
+		speakers.Alternatives[0].Words[0].SpeakerTag = 1
+		results = append(results, speakers)
+	}
+	return stream.Send(&speechpb.StreamingRecognizeResponse{Results: results})
+}
+
+func (f *fakespeech) GetOperation(ctx context.Context, req *lropb.GetOperationRequest) (*lropb.Operation, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	op, ok := f.ops[req.Name]
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "fakespeech: no such operation %q", req.Name)
+	}
+	step := op.steps[len(op.steps)-1]
+	if op.polls < len(op.steps) {
+		step = op.steps[op.polls]
+	}
+	op.polls++
+
+	if step.pollerr != codes.OK {
+		return nil, status.Errorf(step.pollerr, "fakespeech: poll of %q failed", req.Name)
+	}
+
+	md, err := ptypes.MarshalAny(&speechpb.LongRunningRecognizeMetadata{ProgressPercent: step.progress})
+	if err != nil {
+		return nil, err
+	}
+	lop := &lropb.Operation{Name: req.Name, Metadata: md}
+	if (step.failure != nil || step.resp != nil) && !op.done {
+		op.done = true
+		f.running--
+	}
+	switch {
+	case step.failure != nil:
+		lop.Done = true
+		lop.Result = &lropb.Operation_Error{Error: step.failure.Proto()}
+	case step.resp != nil:
+		resp, err := ptypes.MarshalAny(step.resp)
+		if err != nil {
+			return nil, err
+		}
+		lop.Done = true
+		lop.Result = &lropb.Operation_Response{Response: resp}
+	}
+	return lop, nil
+}
+
+func (f *fakespeech) ListOperations(ctx context.Context, req *lropb.ListOperationsRequest) (*lropb.ListOperationsResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "fakespeech: ListOperations")
+}
+
+func (f *fakespeech) CancelOperation(ctx context.Context, req *lropb.CancelOperationRequest) (*empty.Empty, error) {
+	return nil, status.Error(codes.Unimplemented, "fakespeech: CancelOperation")
+}
+
+func (f *fakespeech) DeleteOperation(ctx context.Context, req *lropb.DeleteOperationRequest) (*empty.Empty, error) {
+	return nil, status.Error(codes.Unimplemented, "fakespeech: DeleteOperation")
+}
+
+func (f *fakespeech) WaitOperation(ctx context.Context, req *lropb.WaitOperationRequest) (*lropb.Operation, error) {
+	return nil, status.Error(codes.Unimplemented, "fakespeech: WaitOperation")
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"cloud.google.com/go/storage"
+	"golang.org/x/net/context"
+	speechpb "google.golang.org/genproto/googleapis/cloud/speech/v1p1beta1"
+)
+
+// joingcs appends name to the gs:// prefix.
+func joingcs(prefix, name string) string {
+	return strings.TrimSuffix(prefix, "/") + "/" + strings.TrimPrefix(name, "/")
+}
+
+// resulturi returns where the local file fn about a result is copied to
+// under the -out prefix. Relative paths keep their directories.
+func resulturi(fn string) string {
+	if filepath.IsAbs(fn) || strings.HasPrefix(filepath.Clean(fn), "..") {
+		fn = filepath.Base(fn)
+	}
+	return joingcs(*outprefix, filepath.ToSlash(filepath.Clean(fn)))
+}
+
+// resultexists returns where the result outputfile has already been
+// saved, locally, under its legacy name or under the -out prefix, or ""
+// if it hasn't been.
+func resultexists(ctx context.Context, outputfile string) string {
+	for _, fn := range []string{outputfile, legacyname(outputfile)} {
+		if _, err := os.Stat(fn); fn != "" && !os.IsNotExist(err) {
+			return fn
+		}
+	}
+	if *outprefix == "" {
+		return ""
+	}
+	uri := resulturi(outputfile)
+	bucket, name, err := splitgcsuri(uri)
+	if err != nil {
+		return ""
+	}
+	client, err := storageclient(ctx)
+	if err != nil {
+		log.Printf("can't check for %s: %v", uri, err)
+		return ""
+	}
+	if _, err := client.Bucket(bucket).Object(name).Attrs(ctx); err != nil {
+		if err != storage.ErrObjectNotExist {
+			log.Printf("can't check for %s: %v", uri, err)
+		}
+		return ""
+	}
+	return uri
+}
+
+// copytogcs copies the local file fn to the object at gcsURI.
+func copytogcs(ctx context.Context, fn, gcsURI string) error {
+	bucket, name, err := splitgcsuri(gcsURI)
+	if err != nil {
+		return err
+	}
+	client, err := storageclient(ctx)
+	if err != nil {
+		return err
+	}
+	sum, err := filemd5(fn)
+	if err != nil {
+		return err
+	}
+	fd, err := os.Open(fn)
+	if err != nil {
+		return err
+	}
+	defer fd.Close()
+
+	w := client.Bucket(bucket).Object(name).NewWriter(ctx)
+	w.ContentType = "application/json"
+	if strings.HasSuffix(fn, ".gz") {
+		w.ContentType = "application/gzip"
+	}
+	w.MD5 = sum
+	if _, err := io.Copy(w, fd); err != nil {
+		w.Close()
+		return fmt.Errorf("can't copy %s to %s: %v", fn, gcsURI, err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("can't copy %s to %s: %v", fn, gcsURI, err)
+	}
+	return nil
+}
+
+// saveresultgcs copies the saved result outputfile and its provenance
+// to the -out prefix.
+func saveresultgcs(ctx context.Context, outputfile string) error {
+	for _, fn := range []string{metaname(outputfile), outputfile} {
+		if err := copytogcs(ctx, fn, resulturi(fn)); err != nil {
+			return err
+		}
+		log.Printf("copied %s to %s", fn, resulturi(fn))
+	}
+	return nil
+}
+
+// countwords returns the number of words in the transcripts of resp.
+func countwords(resp *speechpb.LongRunningRecognizeResponse) int {
+	n := 0
+	for _, r := range resp.Results {
+		for _, a := range r.Alternatives {
+			n += len(strings.Fields(a.Transcript))
+		}
+	}
+	return n
+}
+
+// verifyresult reads back the saved result outputfile, from the -out
+// prefix if there is one, and checks that it parses and has words. The
+// audio is only cleaned up if it does.
+func verifyresult(ctx context.Context, outputfile string) error {
+	var resp *speechpb.LongRunningRecognizeResponse
+	var err error
+	where := outputfile
+	if *outprefix == "" {
+		resp, err = loadresult(outputfile)
+	} else {
+		where = resulturi(outputfile)
+		bucket, name, serr := splitgcsuri(where)
+		if serr != nil {
+			return serr
+		}
+		client, cerr := storageclient(ctx)
+		if cerr != nil {
+			return cerr
+		}
+		reader, rerr := client.Bucket(bucket).Object(name).NewReader(ctx)
+		if rerr != nil {
+			return fmt.Errorf("%s: %v", where, rerr)
+		}
+		defer reader.Close()
+		resp, err = decoderesult(reader, where)
+	}
+	if err != nil {
+		return err
+	}
+	if countwords(resp) == 0 {
+		return fmt.Errorf("%s has no words", where)
+	}
+	return nil
+}
+
+// cleanupaudio deletes the audio object at gcsURI or, with -archive,
+// moves it under the archive prefix. An archived copy must have the
+// same checksum as the audio before the audio is deleted.
+func cleanupaudio(ctx context.Context, gcsURI string) error {
+	bucket, name, err := splitgcsuri(gcsURI)
+	if err != nil {
+		return err
+	}
+	client, err := storageclient(ctx)
+	if err != nil {
+		return err
+	}
+	src := client.Bucket(bucket).Object(name)
+
+	if *archiveprefix != "" {
+		attrs, err := src.Attrs(ctx)
+		if err != nil {
+			return fmt.Errorf("%s: %v", gcsURI, err)
+		}
+		archiveuri := joingcs(*archiveprefix, path.Join(bucket, name))
+		dbucket, dname, err := splitgcsuri(archiveuri)
+		if err != nil {
+			return err
+		}
+		copied, err := client.Bucket(dbucket).Object(dname).CopierFrom(src).Run(ctx)
+		if err != nil {
+			return fmt.Errorf("can't archive %s to %s: %v", gcsURI, archiveuri, err)
+		}
+		if !bytes.Equal(copied.MD5, attrs.MD5) {
+			return fmt.Errorf("archived %s to %s but the checksums differ", gcsURI, archiveuri)
+		}
+		log.Printf("archived %s to %s", gcsURI, archiveuri)
+	}
+
+	if err := src.Delete(ctx); err != nil {
+		return fmt.Errorf("can't delete %s: %v", gcsURI, err)
+	}
+	log.Printf("deleted %s", gcsURI)
+	return nil
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/context"
+	speechpb "google.golang.org/genproto/googleapis/cloud/speech/v1p1beta1"
+)
+
+func TestDotranscribeOutAndArchive(t *testing.T) {
+	defer intempdir(t)()
+	g, shutdowngcs := usefakegcs(t)
+	defer shutdowngcs()
+	defer func(out, archive string) {
+		*outprefix = out
+		*archiveprefix = archive
+	}(*outprefix, *archiveprefix)
+	*outprefix = "gs://results/run1/"
+	*archiveprefix = "gs://cold/archive"
+
+	audio := []byte("some audio")
+	g.put("audioscratch", "clip.wav", audio)
+	f := newFakespeech()
+	f.scripts["gs://audioscratch/clip.wav"] = []fakestep{{resp: cannedresp}}
+	rec, shutdown := newFakeRecognizer(t, f)
+	defer shutdown()
+
+	ctx := context.Background()
+	if err := dotranscribe(ctx, rec, "clip.wav"); err != nil {
+		t.Fatalf("dotranscribe failed: %v", err)
+	}
+	saved := g.get("results", "run1/clip-en-US.json")
+	if !bytes.Contains(saved, []byte(`"transcript":"hello there"`)) {
+		t.Errorf("saved %q to GCS", saved)
+	}
+	if g.get("results", "run1/clip-en-US.meta.json") == nil {
+		t.Error("provenance wasn't saved to GCS")
+	}
+	if _, err := os.Stat("clip-en-US.json"); err != nil {
+		t.Errorf("result wasn't saved locally: %v", err)
+	}
+	if g.get("audioscratch", "clip.wav") != nil {
+		t.Error("audio wasn't removed")
+	}
+	if got := g.get("cold", "archive/audioscratch/clip.wav"); !bytes.Equal(got, audio) {
+		t.Errorf("archived %q, want %q", got, audio)
+	}
+
+	// A result in GCS is enough to skip the audio.
+	if err := os.Remove("clip-en-US.json"); err != nil {
+		t.Fatal(err)
+	}
+	if err := dotranscribe(ctx, rec, "clip.wav"); err != nil {
+		t.Fatalf("second dotranscribe failed: %v", err)
+	}
+	if got, want := len(f.submitted), 1; got != want {
+		t.Errorf("submitted %d requests, want %d", got, want)
+	}
+}
+
+func TestDotranscribeKeepsAudioWithoutWords(t *testing.T) {
+	defer intempdir(t)()
+	g, shutdowngcs := usefakegcs(t)
+	defer shutdowngcs()
+	defer func(old bool) { *deleteaudio = old }(*deleteaudio)
+	*deleteaudio = true
+
+	g.put("audioscratch", "silence.wav", []byte("quiet"))
+	g.put("audioscratch", "clip.wav", []byte("noisy"))
+	f := newFakespeech()
+	f.scripts["gs://audioscratch/silence.wav"] = []fakestep{{resp: &speechpb.LongRunningRecognizeResponse{
+		Results: []*speechpb.SpeechRecognitionResult{{Alternatives: []*speechpb.SpeechRecognitionAlternative{{}}}},
+	}}}
+	f.scripts["gs://audioscratch/clip.wav"] = []fakestep{{resp: cannedresp}}
+	rec, shutdown := newFakeRecognizer(t, f)
+	defer shutdown()
+
+	ctx := context.Background()
+	if err := dotranscribe(ctx, rec, "silence.wav"); err == nil || !strings.Contains(err.Error(), "no words") {
+		t.Errorf("cleaning up audio without words gave %v", err)
+	}
+	if g.get("audioscratch", "silence.wav") == nil {
+		t.Error("audio without words was deleted")
+	}
+	if err := dotranscribe(ctx, rec, "clip.wav"); err != nil {
+		t.Fatalf("dotranscribe failed: %v", err)
+	}
+	if g.get("audioscratch", "clip.wav") != nil {
+		t.Error("audio wasn't deleted")
+	}
+	if g.copies != 0 {
+		t.Errorf("made %d copies, want none", g.copies)
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	speechpb "google.golang.org/genproto/googleapis/cloud/speech/v1p1beta1"
+)
+
+// Limits on phrase hints imposed by the Speech API.
+const (
+	maxphrases      = 5000
+	maxphraselength = 100
+	maxphrasechars  = 100000
+	maxboost        = 20
+)
+
+// glossaryname is the glossary file in a project directory.
+const glossaryname = "glossary.txt"
+
+// phrasehints are the speech contexts added to every transcription.
+var phrasehints []*speechpb.SpeechContext
+
+// readglossary reads the glossary file fn and turns it into speech
+// contexts. Each line is a phrase, optionally followed by | and a
+// boost value. Blank lines and lines starting with # are ignored.
+func readglossary(fn string) ([]*speechpb.SpeechContext, error) {
+	fd, err := os.Open(fn)
+	if err != nil {
+		return nil, err
+	}
+	defer fd.Close()
+
+	// Phrases with the same boost share a speech context.
+	byboost := make(map[float32][]string)
+	phrases := 0
+	chars := 0
+	scanner := bufio.NewScanner(fd)
+	for lineno := 1; scanner.Scan(); lineno++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		phrase := line
+		boost := float32(0)
+		if i := strings.LastIndex(line, "|"); i >= 0 {
+			phrase = strings.TrimSpace(line[:i])
+			b, err := strconv.ParseFloat(strings.TrimSpace(line[i+1:]), 32)
+			if err != nil {
+				return nil, fmt.Errorf("%s:%d: bad boost: %v", fn, lineno, err)
+			}
+			if b < 0 || b > maxboost {
+				return nil, fmt.Errorf("%s:%d: boost %v is not between 0 and %d", fn, lineno, b, maxboost)
+			}
+			boost = float32(b)
+		}
+		if phrase == "" {
+			return nil, fmt.Errorf("%s:%d: no phrase", fn, lineno)
+		}
+		if n := len([]rune(phrase)); n > maxphraselength {
+			return nil, fmt.Errorf("%s:%d: phrase is %d characters, the limit is %d", fn, lineno, n, maxphraselength)
+		}
+
+		phrases++
+		chars += len([]rune(phrase))
+		byboost[boost] = append(byboost[boost], phrase)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if phrases > maxphrases {
+		return nil, fmt.Errorf("%s: has %d phrases, the limit is %d", fn, phrases, maxphrases)
+	}
+	if chars > maxphrasechars {
+		return nil, fmt.Errorf("%s: has %d characters of phrases, the limit is %d", fn, chars, maxphrasechars)
+	}
+
+	boosts := make([]float64, 0, len(byboost))
+	for b := range byboost {
+		boosts = append(boosts, float64(b))
+	}
+	sort.Float64s(boosts)
+	contexts := make([]*speechpb.SpeechContext, 0, len(boosts))
+	for _, b := range boosts {
+		contexts = append(contexts, &speechpb.SpeechContext{
+			Phrases: byboost[float32(b)],
+			Boost:   float32(b),
+		})
+	}
+	return contexts, nil
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	speechpb "google.golang.org/genproto/googleapis/cloud/speech/v1p1beta1"
+)
+
+func TestReadglossary(t *testing.T) {
+	dir, err := ioutil.TempDir("", "transcribe")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	fn := filepath.Join(dir, glossaryname)
+
+	tt := []struct {
+		name     string
+		glossary string
+		want     []*speechpb.SpeechContext
+		iserr    bool
+	}{
+		{
+			"boosts",
+			"# family\nKroeger | 15\nOttawa\n\n  Gatineau  |  15 \nPoutine|5\n",
+			[]*speechpb.SpeechContext{
+				{Phrases: []string{"Ottawa"}},
+				{Phrases: []string{"Poutine"}, Boost: 5},
+				{Phrases: []string{"Kroeger", "Gatineau"}, Boost: 15},
+			},
+			false,
+		},
+		{"bad boost", "Kroeger | lots\n", nil, true},
+		{"big boost", "Kroeger | 21\n", nil, true},
+		{"no phrase", " | 10\n", nil, true},
+		{"long phrase", strings.Repeat("x", maxphraselength+1) + "\n", nil, true},
+		{"too many phrases", strings.Repeat("x\n", maxphrases+1), nil, true},
+		{"too many characters", strings.Repeat(strings.Repeat("x", 50)+"\n", maxphrasechars/50+1), nil, true},
+	}
+
+	for _, tv := range tt {
+		if err := ioutil.WriteFile(fn, []byte(tv.glossary), 0644); err != nil {
+			t.Fatal(err)
+		}
+		got, err := readglossary(fn)
+		if tv.iserr {
+			if err == nil {
+				t.Errorf("%s: no error", tv.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", tv.name, err)
+			continue
+		}
+		if len(got) != len(tv.want) {
+			t.Errorf("%s: got %v, want %v", tv.name, got, tv.want)
+			continue
+		}
+		for i := range got {
+			if !proto.Equal(got[i], tv.want[i]) {
+				t.Errorf("%s: [%d] got %v, want %v", tv.name, i, got[i], tv.want[i])
+			}
+		}
+	}
+}
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"mime/multipart"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/golang/protobuf/ptypes"
+	"github.com/googleapis/gax-go/v2"
+	"github.com/rjkroege/transcription/httpstt"
+	"golang.org/x/net/context"
+	speechpb "google.golang.org/genproto/googleapis/cloud/speech/v1p1beta1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// The speech recognition backends.
+const (
+	backendgoogle = "google"
+	backendhttp   = "http"
+)
+
+// httpkeyenv names the environment variable holding the API key for the
+// http backend.
+const httpkeyenv = "TRANSCRIBE_HTTP_KEY"
+
+// httprecognizer transcribes by posting the audio to a self-hosted
+// recognizer with an OpenAI style /v1/audio/transcriptions API. The
+// request is multipart form data with these fields:
+//
+//	file                       the WAV or FLAC audio
+//	model                      the -httpmodel model
+//	language                   the ISO-639-1 language, e.g. en
+//	response_format            verbose_json
+//	timestamp_granularities[]  segment and word
+//
+// The reply is the verbose JSON described by httpstt.Transcription.
+type httprecognizer struct {
+	client   *http.Client
+	endpoint string
+	model    string
+	key      string
+}
+
+// newHTTPRecognizer makes a recognizer posting to endpoint. key is sent
+// as a bearer token if set.
+func newHTTPRecognizer(endpoint, model, key string) *httprecognizer {
+	return &httprecognizer{
+		client:   http.DefaultClient,
+		endpoint: endpoint,
+		model:    model,
+		key:      key,
+	}
+}
+
+func (h *httprecognizer) Recognize(ctx context.Context, req *speechpb.RecognizeRequest) (*speechpb.RecognizeResponse, error) {
+	content := req.GetAudio().GetContent()
+	if len(content) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "the http backend needs inline audio")
+	}
+	results, err := h.post(ctx, req.Config, "audio", content)
+	if err != nil {
+		return nil, err
+	}
+	return &speechpb.RecognizeResponse{Results: results}, nil
+}
+
+func (h *httprecognizer) Stream(ctx context.Context) (speechpb.Speech_StreamingRecognizeClient, error) {
+	return nil, status.Error(codes.Unimplemented, "the http backend can't stream")
+}
+
+// Submit fetches the audio from GCS and transcribes it before
+// returning an operation that is already done.
+func (h *httprecognizer) Submit(ctx context.Context, req *speechpb.LongRunningRecognizeRequest) (operation, error) {
+	gcsURI := req.GetAudio().GetUri()
+	bucket, name, err := splitgcsuri(gcsURI)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	client, err := storageclient(ctx)
+	if err != nil {
+		return nil, err
+	}
+	reader, err := client.Bucket(bucket).Object(name).NewReader(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", gcsURI, err)
+	}
+	defer reader.Close()
+	content, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", gcsURI, err)
+	}
+
+	results, err := h.post(ctx, req.Config, path.Base(name), content)
+	if err != nil {
+		return nil, err
+	}
+	return &doneop{
+		name: "http/" + gcsURI,
+		resp: &speechpb.LongRunningRecognizeResponse{Results: results},
+	}, nil
+}
+
+// Reattach can't find transcriptions that were running when transcribe
+// stopped because the recognizer doesn't keep them. The operation fails
+// with NotFound so that the audio is submitted again.
+func (h *httprecognizer) Reattach(name string) operation {
+	return &doneop{
+		name: name,
+		err:  status.Errorf(codes.NotFound, "the http backend can't reattach to %s", name),
+	}
+}
+
+func (h *httprecognizer) Close() error {
+	return nil
+}
+
+// post sends the audio in content to the recognizer and converts the
+// reply to recognition results.
+func (h *httprecognizer) post(ctx context.Context, config *speechpb.RecognitionConfig, filename string, content []byte) ([]*speechpb.SpeechRecognitionResult, error) {
+	body := new(bytes.Buffer)
+	mw := multipart.NewWriter(body)
+	fw, err := mw.CreateFormFile("file", filename)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := fw.Write(content); err != nil {
+		return nil, err
+	}
+	fields := [][2]string{
+		{"model", h.model},
+		{"language", strings.SplitN(config.GetLanguageCode(), "-", 2)[0]},
+		{"response_format", "verbose_json"},
+		{"timestamp_granularities[]", "segment"},
+		{"timestamp_granularities[]", "word"},
+	}
+	for _, f := range fields {
+		if err := mw.WriteField(f[0], f[1]); err != nil {
+			return nil, err
+		}
+	}
+	if err := mw.Close(); err != nil {
+		return nil, err
+	}
+
+	hreq, err := http.NewRequest(http.MethodPost, h.endpoint, body)
+	if err != nil {
+		return nil, err
+	}
+	hreq = hreq.WithContext(ctx)
+	hreq.Header.Set("Content-Type", mw.FormDataContentType())
+	if h.key != "" {
+		hreq.Header.Set("Authorization", "Bearer "+h.key)
+	}
+	hresp, err := h.client.Do(hreq)
+	if err != nil {
+		return nil, status.Error(codes.Unavailable, err.Error())
+	}
+	defer hresp.Body.Close()
+	if hresp.StatusCode != http.StatusOK {
+		msg, _ := ioutil.ReadAll(io.LimitReader(hresp.Body, 1024))
+		return nil, status.Errorf(httpcode(hresp.StatusCode), "%s: %s: %s", h.endpoint, hresp.Status, bytes.TrimSpace(msg))
+	}
+
+	var tr httpstt.Transcription
+	if err := json.NewDecoder(hresp.Body).Decode(&tr); err != nil {
+		return nil, fmt.Errorf("%s: bad reply: %v", h.endpoint, err)
+	}
+	return httpresults(&tr, config.GetLanguageCode()), nil
+}
+
+// httpcode maps an HTTP status to the gRPC code with the same meaning so
+// that transient failures are treated the same way for both backends.
+func httpcode(code int) codes.Code {
+	switch {
+	case code == http.StatusBadRequest:
+		return codes.InvalidArgument
+	case code == http.StatusUnauthorized:
+		return codes.Unauthenticated
+	case code == http.StatusForbidden:
+		return codes.PermissionDenied
+	case code == http.StatusNotFound:
+		return codes.NotFound
+	case code == http.StatusTooManyRequests:
+		return codes.ResourceExhausted
+	case code >= 500:
+		return codes.Unavailable
+	}
+	return codes.Unknown
+}
+
+// httpresults converts the reply tr into one result per segment holding
+// the words spoken in it. The confidence of a segment comes from its
+// average log probability.
+func httpresults(tr *httpstt.Transcription, language string) []*speechpb.SpeechRecognitionResult {
+	results := make([]*speechpb.SpeechRecognitionResult, 0, len(tr.Segments))
+	w := 0
+	for i, seg := range tr.Segments {
+		alt := &speechpb.SpeechRecognitionAlternative{
+			Transcript: strings.TrimSpace(seg.Text),
+		}
+		if seg.AvgLogprob != 0 {
+			alt.Confidence = float32(math.Exp(seg.AvgLogprob))
+		}
+		// Words starting before the next segment belong to this one.
+		for ; w < len(tr.Words) && (i == len(tr.Segments)-1 || tr.Words[w].Start < tr.Segments[i+1].Start); w++ {
+			alt.Words = append(alt.Words, &speechpb.WordInfo{
+				Word:      strings.TrimSpace(tr.Words[w].Word),
+				StartTime: ptypes.DurationProto(seconds(tr.Words[w].Start)),
+				EndTime:   ptypes.DurationProto(seconds(tr.Words[w].End)),
+			})
+		}
+		results = append(results, &speechpb.SpeechRecognitionResult{
+			Alternatives: []*speechpb.SpeechRecognitionAlternative{alt},
+			LanguageCode: language,
+		})
+	}
+	return results
+}
+
+// seconds converts a time in seconds from the reply to a duration.
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
+
+// describe returns the backend and model for the provenance.
+func (h *httprecognizer) describe() string {
+	return fmt.Sprintf("%s %s (model %s)", backendhttp, h.endpoint, h.model)
+}
+
+// doneop is an operation that has already finished.
+type doneop struct {
+	name string
+	resp *speechpb.LongRunningRecognizeResponse
+	err  error
+}
+
+func (d *doneop) Name() string {
+	return d.name
+}
+
+func (d *doneop) Done() bool {
+	return true
+}
+
+func (d *doneop) Poll(ctx context.Context, opts ...gax.CallOption) (*speechpb.LongRunningRecognizeResponse, error) {
+	return d.resp, d.err
+}
+
+func (d *doneop) Metadata() (*speechpb.LongRunningRecognizeMetadata, error) {
+	return &speechpb.LongRunningRecognizeMetadata{ProgressPercent: 100}, nil
+}
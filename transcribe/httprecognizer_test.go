@@ -0,0 +1,153 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const verbosereply = `{
+	"language": "english",
+	"duration": 3.5,
+	"text": "Hello there. General Kenobi.",
+	"segments": [
+		{"start": 0.0, "end": 1.5, "text": " Hello there.", "avg_logprob": -0.1},
+		{"start": 2.0, "end": 3.5, "text": " General Kenobi.", "avg_logprob": -0.5}
+	],
+	"words": [
+		{"word": " Hello", "start": 0.0, "end": 0.5},
+		{"word": " there.", "start": 0.75, "end": 1.5},
+		{"word": " General", "start": 2.0, "end": 2.5},
+		{"word": " Kenobi.", "start": 2.75, "end": 3.5}
+	]
+}`
+
+func TestDotranscribeHTTP(t *testing.T) {
+	defer intempdir(t)()
+	g, shutdowngcs := usefakegcs(t)
+	defer shutdowngcs()
+	f, rec, shutdown := usefakehttpstt(t, verbosereply)
+	defer shutdown()
+	defer func(old string) { *backend = old }(*backend)
+	*backend = backendhttp
+
+	// Too long to go inline to Google.
+	long := makewav(8000, 1, 2*time.Minute)
+	if err := ioutil.WriteFile("long.wav", long, 0644); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	if err := dotranscribe(ctx, rec, "long.wav"); err != nil {
+		t.Fatalf("dotranscribe failed: %v", err)
+	}
+	if g.get("audioscratch", "long.wav") != nil {
+		t.Error("audio was uploaded")
+	}
+	if got, want := len(f.Requests()), 1; got != want {
+		t.Fatalf("made %d requests, want %d", got, want)
+	}
+	req := f.Requests()[0]
+	if !bytes.Equal(req.Audio, long) {
+		t.Errorf("posted %d bytes, want %d", len(req.Audio), len(long))
+	}
+	if got, want := req.Auth, "Bearer sekrit"; got != want {
+		t.Errorf("sent authorization %q, want %q", got, want)
+	}
+	for k, want := range map[string][]string{
+		"model":                     {"tiny"},
+		"language":                  {"en"},
+		"response_format":           {"verbose_json"},
+		"timestamp_granularities[]": {"segment", "word"},
+	} {
+		if got := req.Fields[k]; !reflect.DeepEqual(got, want) {
+			t.Errorf("sent %s %v, want %v", k, got, want)
+		}
+	}
+
+	resp := readresult(t, "long-en-US.json")
+	if got, want := len(resp.Results), 2; got != want {
+		t.Fatalf("saved %d results, want %d", got, want)
+	}
+	second := resp.Results[1]
+	if got, want := second.Alternatives[0].Transcript, "General Kenobi."; got != want {
+		t.Errorf("saved transcript %q, want %q", got, want)
+	}
+	if got, want := second.LanguageCode, "en-US"; got != want {
+		t.Errorf("saved language %q, want %q", got, want)
+	}
+	if c := second.Alternatives[0].Confidence; c < 0.6 || c > 0.61 {
+		t.Errorf("saved confidence %v, want exp(-0.5)", c)
+	}
+	words := second.Alternatives[0].Words
+	if len(words) != 2 || words[0].Word != "General" || words[1].EndTime.Seconds != 3 || words[1].EndTime.Nanos != 5e8 {
+		t.Errorf("saved words %v", words)
+	}
+	prov := readprovenance(t, "long-en-US.meta.json")
+	if prov.Method != methodinline || !strings.Contains(prov.Backend, "model tiny") {
+		t.Errorf("recorded method %q and backend %q", prov.Method, prov.Backend)
+	}
+
+	// Audio in GCS is fetched and posted.
+	g.put("audioscratch", "remote.wav", long)
+	if err := dotranscribe(ctx, rec, "remote.wav"); err != nil {
+		t.Fatalf("dotranscribe of GCS audio failed: %v", err)
+	}
+	if got := f.Requests()[1]; got.Filename != "remote.wav" || !bytes.Equal(got.Audio, long) {
+		t.Errorf("posted %s with %d bytes", got.Filename, len(got.Audio))
+	}
+	if got := readprovenance(t, "remote-en-US.meta.json").Operation; got != "http/gs://audioscratch/remote.wav" {
+		t.Errorf("recorded operation %q", got)
+	}
+}
+
+func TestHTTPRecognizerFailures(t *testing.T) {
+	f, rec, shutdown := usefakehttpstt(t, verbosereply)
+	defer shutdown()
+	ctx := context.Background()
+
+	f.Code = 503
+	_, err := rec.post(ctx, builtinprofiles["default"].config("en-US", 1), "clip.wav", []byte("audio"))
+	if got, want := status.Code(err), codes.Unavailable; got != want {
+		t.Errorf("server error gave %v, want %v", got, want)
+	}
+	if !istransient(err) {
+		t.Errorf("server error %v isn't transient", err)
+	}
+
+	f.Code = 0
+	f.Reply = []byte("not json")
+	if _, err := rec.post(ctx, builtinprofiles["default"].config("en-US", 1), "clip.wav", []byte("audio")); err == nil {
+		t.Error("bad reply succeeded")
+	}
+
+	if _, err := rec.Reattach("http/gs://audioscratch/clip.wav").Poll(ctx); status.Code(err) != codes.NotFound {
+		t.Errorf("reattaching gave %v", err)
+	}
+}
+
+func TestHTTPRecognizerStandin(t *testing.T) {
+	_, rec, shutdown := usefakehttpstt(t, "")
+	defer shutdown()
+
+	results, err := rec.post(context.Background(), builtinprofiles["default"].config("en-US", 1), "clip.wav", []byte("audio"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 {
+		t.Fatalf("got %d results, want 1", len(results))
+	}
+	alt := results[0].Alternatives[0]
+	if got, want := alt.Transcript, "this is a transcription of clip.wav"; got != want {
+		t.Errorf("got transcript %q, want %q", got, want)
+	}
+	if got, want := len(alt.Words), 6; got != want {
+		t.Errorf("got %d words, want %d", got, want)
+	}
+}
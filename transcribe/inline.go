@@ -0,0 +1,53 @@
+package main
+
+import (
+	"io/ioutil"
+	"log"
+	"os"
+
+	"golang.org/x/net/context"
+	speechpb "google.golang.org/genproto/googleapis/cloud/speech/v1p1beta1"
+)
+
+// maxinlinesize is the most audio that can be sent inline in a single
+// synchronous request.
+const maxinlinesize = 10 << 20
+
+// isinline returns true if the local audio file localpath is short
+// enough to transcribe inline with the synchronous API.
+func isinline(localpath string) bool {
+	if *syncmax <= 0 {
+		return false
+	}
+	fi, err := os.Stat(localpath)
+	if err != nil || fi.Size() > maxinlinesize {
+		return false
+	}
+	info, err := localaudioinfo(localpath)
+	if err != nil {
+		log.Printf("can't tell how long %s is so using GCS: %v", localpath, err)
+		return false
+	}
+	return info.duration <= *syncmax
+}
+
+// sendInline transcribes the contents of the local audio file localpath
+// with a synchronous request using config. The result has the same form as the
+// result of a long running recognition.
+func sendInline(ctx context.Context, rec recognizer, config *speechpb.RecognitionConfig, localpath string) (*speechpb.LongRunningRecognizeResponse, error) {
+	content, err := ioutil.ReadFile(localpath)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := rec.Recognize(ctx, &speechpb.RecognizeRequest{
+		Config: config,
+		Audio: &speechpb.RecognitionAudio{
+			AudioSource: &speechpb.RecognitionAudio_Content{Content: content},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &speechpb.LongRunningRecognizeResponse{Results: resp.Results}, nil
+}
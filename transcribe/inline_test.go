@@ -0,0 +1,67 @@
+package main
+
+import (
+	"bytes"
+	"crypto/md5"
+	"fmt"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+	speechpb "google.golang.org/genproto/googleapis/cloud/speech/v1p1beta1"
+)
+
+func TestDotranscribeInline(t *testing.T) {
+	defer intempdir(t)()
+	g, shutdowngcs := usefakegcs(t)
+	defer shutdowngcs()
+
+	f := newFakespeech()
+	f.inline = &speechpb.RecognizeResponse{Results: cannedresp.Results}
+	f.scripts["gs://audioscratch/long.wav"] = []fakestep{{resp: cannedresp}}
+	rec, shutdown := newFakeRecognizer(t, f)
+	defer shutdown()
+
+	short := makewav(8000, 1, 20*time.Second)
+	if err := ioutil.WriteFile("short.wav", short, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile("long.wav", makewav(8000, 1, 2*time.Minute), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	if err := dotranscribe(ctx, rec, "short.wav"); err != nil {
+		t.Fatalf("dotranscribe of short audio failed: %v", err)
+	}
+	if got, want := len(f.recognized), 1; got != want {
+		t.Fatalf("made %d inline requests, want %d", got, want)
+	}
+	if got := f.recognized[0].Audio.GetContent(); !bytes.Equal(got, short) {
+		t.Errorf("sent %d bytes inline, want %d", len(got), len(short))
+	}
+	if g.get("audioscratch", "short.wav") != nil {
+		t.Error("short audio was uploaded")
+	}
+	if got, want := readresult(t, "short-en-US.json").Results[0].Alternatives[0].Transcript, "hello there"; got != want {
+		t.Errorf("saved transcript %q, want %q", got, want)
+	}
+	prov := readprovenance(t, "short-en-US.meta.json")
+	if got, want := prov.Method, methodinline; got != want {
+		t.Errorf("recorded method %q, want %q", got, want)
+	}
+	if got, want := prov.MD5, fmt.Sprintf("%x", md5.Sum(short)); got != want {
+		t.Errorf("recorded checksum %s, want %s", got, want)
+	}
+
+	if err := dotranscribe(ctx, rec, "long.wav"); err != nil {
+		t.Fatalf("dotranscribe of long audio failed: %v", err)
+	}
+	if got, want := len(f.recognized), 1; got != want {
+		t.Errorf("made %d inline requests, want %d", got, want)
+	}
+	if got, want := len(f.submitted), 1; got != want {
+		t.Errorf("submitted %d requests, want %d", got, want)
+	}
+}
@@ -10,42 +10,81 @@
 package main
 
 import (
-	"encoding/json"
+	"compress/gzip"
 	"flag"
+	"fmt"
+	"io"
 	"log"
+	"net/http"
 	"os"
 	"path/filepath"
 	"strings"
 	"time"
 
+	"github.com/golang/protobuf/jsonpb"
+
 	// Do we still need this? Remove later if we don't actually need it.
 	"golang.org/x/net/context"
 
-	speech "cloud.google.com/go/speech/apiv1p1beta1"
-	"google.golang.org/api/option"
 	speechpb "google.golang.org/genproto/googleapis/cloud/speech/v1p1beta1"
-	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
-const usage = `Usage: transcribe <gcs uri>
+const usage = `Usage: transcribe [-sp <speaker count>] [-profile <name>] -t <gcs uri or local audio file>
+       transcribe [-sp <speaker count>] [-profile <name>] [-j <jobs>] -batch <list file>
+       transcribe [-sp <speaker count>] [-profile <name>] [-j <jobs>] -glob <object pattern>
+       transcribe [-j <jobs>] [-queue <dir>] -serve <address>
 `
 
 const defaultlang = "en-US"
 
+// maxaltlanguages is the most alternative languages the API accepts.
+const maxaltlanguages = 3
+
 var speakercount = flag.Int("sp", 1, "Set the number of speakers in this audio file")
+var profilesfile = flag.String("profiles", "", "read recognition profiles from this JSON file")
+var projectdir = flag.String("project", ".", "project directory holding per-project settings such as "+glossaryname+", "+metadataname+" and "+manifestname)
+var glossaryfile = flag.String("glossary", "", "read phrase hints from this file instead of the project's "+glossaryname)
+var profilename = flag.String("profile", "", "recognition profile to use, defaults to default for 1 speaker and diarize for more")
+var wordconfidence = flag.Bool("wordconfidence", false, "ask for the confidence of each word, adding to the profile")
+var alternatives = flag.Int("alternatives", 0, "ask for up to this many hypotheses of each result, overriding the profile")
 var transcribe = flag.String("t", "", "transcribe the argument")
 var uribase = flag.String("ub", "gs://audioscratch", "find the audio files in this bucket path")
 var language = flag.String("lang", defaultlang, "language code for transcription, defaults to en-US")
+var altlanguages = flag.String("altlang", "", "comma separated list of up to 3 other languages that the audio might be in")
+var batchlist = flag.String("batch", "", "transcribe every object named in this file, one per line")
+var batchglob = flag.String("glob", "", "transcribe every object in the -ub bucket path matching this pattern")
+var jobs = flag.Int("j", 4, "maximum number of transcription jobs in flight at once")
+var storageendpoint = flag.String("storageendpoint", "", "send GCS requests to this endpoint, e.g. http://localhost:4443 for an emulator")
+var syncmax = flag.Duration("syncmax", time.Minute, "transcribe local audio no longer than this inline, 0 to always use GCS")
+var streaming = flag.Bool("stream", false, "transcribe local audio with streaming recognition, showing progress in a .stream.txt file")
+var statefile = flag.String("state", "transcribe-state.json", "record submitted operations here so that they can be resumed")
+var pollinitial = flag.Duration("poll", 30*time.Second, "wait this long before polling an operation the second time")
+var pollmax = flag.Duration("pollmax", 10*time.Minute, "wait no longer than this between polls")
+var maxwait = flag.Duration("maxwait", 24*time.Hour, "give up on an operation this long after it was submitted, 0 to wait forever")
+var retries = flag.Int("retries", 10, "give up on an operation after this many transient poll errors")
+var estimateonly = flag.Bool("estimate", false, "print the estimated cost of each transcription and exit without submitting anything")
+var pricesfile = flag.String("prices", "", "read the price per minute of each model from this JSON file")
+var dryrun = flag.Bool("n", false, "check the audio and print the requests that would be made without submitting anything")
+var serveaddr = flag.String("serve", "", "run a server taking jobs over HTTP on this address, e.g. :8080")
+var queuedir = flag.String("queue", "transcribe-queue", "keep the server's jobs and their results in this directory")
+var compress = flag.Bool("gzip", false, "gzip the saved results")
+var backend = flag.String("backend", backendgoogle, "speech recognition backend: google or http for a self-hosted recognizer")
+var httpendpoint = flag.String("httpendpoint", "http://localhost:8000/v1/audio/transcriptions", "post audio to this URL with the http backend")
+var httpmodel = flag.String("httpmodel", "whisper-1", "ask the http backend for this model")
+var outprefix = flag.String("out", "", "also save results and their provenance under this gs:// prefix")
+var deleteaudio = flag.Bool("deleteaudio", false, "delete the audio object in GCS once its result has been saved and checked")
+var archiveprefix = flag.String("archive", "", "move the audio object under this gs:// prefix once its result has been saved and checked")
+var budget = flag.Float64("budget", 0, "refuse to submit audio once the estimated cost of the run goes over this many dollars, 0 for no limit")
 
 var testlog = flag.Bool("testlog", false,
 	"Log in the conventional way for running in a terminal.")
 
-const dryrun = false
-
 func LogToFile() func() {
 	logFile, err := os.OpenFile("transcribe-log", os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
 	if err != nil {
-		log.Panic("leap couldn't make a logging file: %v", err)
+		log.Panicf("transcribe couldn't make a logging file: %v", err)
 	}
 
 	log.SetOutput(logFile)
@@ -55,130 +94,437 @@ func LogToFile() func() {
 	}
 }
 
-func dotranscribe(shorturi string) {
-	// Prep names.
-	uri := *uribase + "/" + shorturi
+// outputname returns the name of the local JSON file holding the
+// transcription of shorturi. The name includes the languages that the
+// audio was transcribed in.
+func outputname(shorturi string) string {
 	basename := strings.TrimSuffix(shorturi, filepath.Ext(shorturi))
+	outputfile := basename + "-" + strings.Join(languages(), "+") + ".json"
+	if *compress {
+		outputfile += ".gz"
+	}
+	return outputfile
+}
+
+// legacyname returns the name that the result outputfile had when
+// results in the default language weren't labelled with it, or "" if
+// its languages were always in its name. Audio already transcribed
+// under that name isn't transcribed again.
+func legacyname(outputfile string) string {
+	suffix := "-" + defaultlang
+	if *language != defaultlang || len(languages()) > 1 || !strings.HasSuffix(resultbase(outputfile), suffix) {
+		return ""
+	}
+	return strings.TrimSuffix(resultbase(outputfile), suffix) + ".json"
+}
+
+// resultbase is outputfile without its extensions. Other files about
+// the result are named after it.
+func resultbase(outputfile string) string {
+	return strings.TrimSuffix(strings.TrimSuffix(outputfile, ".gz"), ".json")
+}
+
+// languages returns the -lang language followed by the -altlang
+// alternatives.
+func languages() []string {
+	langs := []string{*language}
+	for _, l := range strings.Split(*altlanguages, ",") {
+		if l = strings.TrimSpace(l); l != "" {
+			langs = append(langs, l)
+		}
+	}
+	return langs
+}
+
+// labellanguages makes sure that every result in resp records the
+// language it was recognized in and logs how much of each language was
+// found.
+func labellanguages(resp *speechpb.LongRunningRecognizeResponse, outputfile string) {
+	counts := make(map[string]int)
+	for _, r := range resp.Results {
+		if r.LanguageCode == "" {
+			r.LanguageCode = *language
+		}
+		counts[r.LanguageCode]++
+	}
+	for l, n := range counts {
+		log.Printf("%s: %d results in %s", outputfile, n, l)
+	}
+}
+
+// job is one transcription: where the audio is, where the result goes
+// and how to recognize it.
+type job struct {
+	localpath  string // Local audio to send instead of the object at uri.
+	uri        string
+	outputfile string
+	profile    *profile
+	speakers   int
+}
 
-	// TODO(rjk): This special case is tedious but saves re-running extra
-	// transcription jobs. I should remove this before the next go-round
-	// of the transcription.
-	outputfile := ""
-	if *language == defaultlang {
-		outputfile = basename + ".json"
-	} else {
-		outputfile = basename + "-" +  *language + ".json"
+// dotranscribe transcribes the object shorturi found in the -ub bucket
+// path with rec and saves the result as JSON in the current directory.
+// If shorturi is instead a local audio file, it is first uploaded to the
+// -ub bucket path.
+func dotranscribe(ctx context.Context, rec recognizer, shorturi string) error {
+	// Prep names.
+	localpath := ""
+	if islocalaudio(shorturi) {
+		localpath = shorturi
+		shorturi = filepath.Base(localpath)
 	}
+	return runjob(ctx, rec, &job{
+		localpath:  localpath,
+		uri:        *uribase + "/" + shorturi,
+		outputfile: outputname(shorturi),
+		profile:    activeprofile(),
+		speakers:   *speakercount,
+	})
+}
+
+// method returns how the audio of j is sent to the API. Local files can
+// be streamed and short ones don't need to go through GCS. The http
+// backend takes local files of any length inline.
+func (j *job) method() string {
+	switch {
+	case j.localpath != "" && *backend == backendhttp:
+		return methodinline
+	case j.localpath != "" && *streaming:
+		return methodstreaming
+	case j.localpath != "" && isinline(j.localpath):
+		return methodinline
+	}
+	return methodlongrunning
+}
+
+// runjob does the transcription described by j with rec unless its
+// result already exists.
+func runjob(ctx context.Context, rec recognizer, j *job) error {
+	localpath, uri, outputfile := j.localpath, j.uri, j.outputfile
 
 	// Skip files already done.
-	if _, err := os.Stat(outputfile); !os.IsNotExist(err) {
-		log.Printf("transcription result %s exists. skipping...", outputfile)
-		return
+	if done := resultexists(ctx, outputfile); done != "" {
+		log.Printf("transcription result %s exists. skipping...", done)
+		if *dryrun {
+			writedryrun([]byte(fmt.Sprintf("%s:\n  output: %s exists, would skip\n\n", uri, done)))
+		}
+		return nil
 	}
 
 	log.Printf("transcribe %s to %s with %d speakers",
-		uri, outputfile, *speakercount)
-	if dryrun {
-		return
+		uri, outputfile, j.speakers)
+	prof := j.profile
+	config := prof.config(*language, j.speakers)
+	config.SpeechContexts = phrasehints
+	config.Metadata = metadatafor(uri)
+	config.AlternativeLanguageCodes = languages()[1:]
+	method := j.method()
+	if *dryrun {
+		return dryrunjob(ctx, j, method, config)
+	}
+	if config.EnableSeparateRecognitionPerChannel {
+		info, err := jobaudioinfo(ctx, j)
+		if err != nil {
+			return err
+		}
+		if err := setchannels(config, info); err != nil {
+			return fmt.Errorf("%s: %v", uri, err)
+		}
 	}
 
 	// Do the transcription.
-	ctx := context.Background()
-	client, err := speech.NewClient(ctx, option.WithGRPCDialOption(grpc.WithDefaultCallOptions(grpc.MaxCallRecvMsgSize(1<<30))))
+	prov := &provenance{
+		Source:    uri,
+		Local:     localpath,
+		Speakers:  j.speakers,
+		Profile:   prof,
+		Config:    config,
+		Method:    method,
+		Submitted: time.Now(),
+		Version:   toolversion(),
+	}
+	if h, ok := rec.(*httprecognizer); ok {
+		prov.Backend = h.describe()
+	}
+	var resp *speechpb.LongRunningRecognizeResponse
+	var err error
+	switch method {
+	case methodstreaming:
+		log.Println("streaming", localpath, "progress to", streamoutputname(outputfile))
+		resp, err = sendStreaming(ctx, rec, config, localpath, outputfile)
+	case methodinline:
+		log.Println("transcribing", localpath, "inline")
+		resp, err = sendInline(ctx, rec, config, localpath)
+	default:
+		if localpath != "" {
+			if err := uploadaudio(ctx, localpath, uri); err != nil {
+				return err
+			}
+		}
+		log.Println("waiting for transcription of", outputfile)
+		resp, err = sendGCS(ctx, rec, config, uri, outputfile)
+		// The operation stays pending until the result is saved.
+		if p := pending.lookup(outputfile); p != nil {
+			prov.Operation = p.Name
+			prov.Submitted = p.Submitted
+		}
+	}
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
+	prov.Finished = time.Now()
+	labellanguages(resp, outputfile)
 
-	log.Println("waiting for transcription of", outputfile)
-	resp, err := sendGCS(client, uri)
-	if err != nil {
-		log.Fatal(err)
+	if prov.MD5, err = audiomd5(ctx, localpath, uri); err != nil {
+		log.Printf("%s: can't record the audio checksum: %v", uri, err)
+	}
+	if err := writeprovenance(prov, outputfile); err != nil {
+		return fmt.Errorf("can't write out the provenance of %s because: %v", outputfile, err)
 	}
 
 	// Output the result.
-	fd, err := os.Create(outputfile)
-	if err != nil {
-		log.Fatalln("can't open the file", "transcript.json", "because", err)
+	if err := saveresult(resp, outputfile); err != nil {
+		return fmt.Errorf("can't write out %s because: %v", outputfile, err)
 	}
-	defer fd.Close()
-	saver := json.NewEncoder(fd)
-	if err := saver.Encode(resp); err != nil {
-		log.Println("Can't write out the response as a json because:", err)
+	if *outprefix != "" {
+		if err := saveresultgcs(ctx, outputfile); err != nil {
+			return fmt.Errorf("can't save %s to %s because: %v", outputfile, *outprefix, err)
+		}
+	}
+	if err := pending.remove(outputfile); err != nil {
+		log.Printf("%s: can't update saved operations: %v", outputfile, err)
 	}
 	log.Println("completed transcribing to", outputfile)
+
+	// Only audio in GCS is cleaned up. Local files stay where they are.
+	if (*deleteaudio || *archiveprefix != "") && method == methodlongrunning {
+		if err := verifyresult(ctx, outputfile); err != nil {
+			return fmt.Errorf("not cleaning up %s: %v", uri, err)
+		}
+		if err := cleanupaudio(ctx, uri); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 func main() {
 	flag.Parse()
+
+	// Exit with the status of the worst failure after the log is closed.
+	status := exitok
+	defer func() {
+		if status != exitok {
+			os.Exit(status)
+		}
+	}()
 	if !*testlog {
 		defer LogToFile()()
 	}
 
-	if *transcribe != "" {
-		dotranscribe(*transcribe)
+	if *serveaddr != "" && (*transcribe != "" || *batchlist != "" || *batchglob != "") {
+		log.Fatal("can't serve jobs and transcribe -t, -batch or -glob at the same time")
+	}
+
+	var shorturis []string
+	switch {
+	case *transcribe != "":
+		shorturis = []string{*transcribe}
+	case *batchlist != "":
+		names, err := readbatchlist(*batchlist)
+		if err != nil {
+			log.Fatalf("can't read batch list %s: %v", *batchlist, err)
+		}
+		shorturis = names
+	case *batchglob != "":
+		names, err := globobjects(context.Background(), *uribase, *batchglob)
+		if err != nil {
+			log.Fatalf("can't list objects matching %s: %v", *batchglob, err)
+		}
+		shorturis = names
+	case *serveaddr != "":
+	default:
+		io.WriteString(os.Stderr, usage)
 		return
 	}
-}
 
-func sendGCS(client *speech.Client, gcsURI string) (*speechpb.LongRunningRecognizeResponse, error) {
+	if n := len(languages()) - 1; n > maxaltlanguages {
+		log.Fatalf("-altlang has %d languages, the limit is %d", n, maxaltlanguages)
+	}
+
+	for _, prefix := range []string{*outprefix, *archiveprefix} {
+		if _, _, err := splitgcsuri(prefix); prefix != "" && err != nil {
+			log.Fatalf("bad output prefix: %v", err)
+		}
+	}
+	if *deleteaudio && *archiveprefix != "" {
+		log.Fatal("use one of -deleteaudio and -archive")
+	}
+
+	profiles, err := readprofiles(*profilesfile)
+	if err != nil {
+		log.Fatalf("can't read profiles: %v", err)
+	}
+	chosen, err = pickprofile(profiles, *profilename, *speakercount)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if chosen, err = chosen.withextras(*wordconfidence, *alternatives); err != nil {
+		log.Fatalf("bad -alternatives: %v", err)
+	}
+
+	gfn := *glossaryfile
+	if gfn == "" {
+		gfn = filepath.Join(*projectdir, glossaryname)
+	}
+	if hints, err := readglossary(gfn); err == nil {
+		phrasehints = hints
+	} else if *glossaryfile != "" || !os.IsNotExist(err) {
+		log.Fatalf("can't use glossary: %v", err)
+	}
+	if err := loadprojectmetadata(*projectdir); err != nil {
+		log.Fatalf("can't use project metadata: %v", err)
+	}
+
+	st, err := loadstate(*statefile)
+	if err != nil {
+		log.Fatalf("can't read pending operations from %s: %v", *statefile, err)
+	}
+	pending = st
+
+	if *estimateonly || *budget > 0 {
+		prices, err := readprices(*pricesfile)
+		if err != nil {
+			log.Fatalf("can't read prices: %v", err)
+		}
+		estimates := estimatebatch(context.Background(), shorturis, prices, chosen)
+		if *estimateonly {
+			if err := writeestimates(os.Stdout, estimates); err != nil {
+				log.Fatal(err)
+			}
+			return
+		}
+		if refused := overbudget(estimates, *budget); len(refused) > 0 {
+			status = exitbudget
+			accepted := make([]string, 0, len(shorturis))
+			for _, s := range shorturis {
+				if !refused[s] {
+					accepted = append(accepted, s)
+				}
+			}
+			shorturis = accepted
+		}
+	}
+
+	// A dry run doesn't talk to the Speech API.
 	ctx := context.Background()
-	var req *speechpb.LongRunningRecognizeRequest
-
-	if *speakercount == 1 {
-		// Send the contents of the audio file with the encoding and
-		// and sample rate information to be transcripted.
-		req = &speechpb.LongRunningRecognizeRequest{
-			Config: &speechpb.RecognitionConfig{
-				// These are optional yes?
-				//Encoding:        speechpb.RecognitionConfig_LINEAR16,
-				//SampleRateHertz: 16000,
-				LanguageCode: *language,
-			},
-			Audio: &speechpb.RecognitionAudio{
-				AudioSource: &speechpb.RecognitionAudio_Uri{Uri: gcsURI},
-			},
-		}
-	} else {
-		// Send the contents of the audio file with the encoding and
-		// and sample rate information to be transcripted.
-		req = &speechpb.LongRunningRecognizeRequest{
-			Config: &speechpb.RecognitionConfig{
-				// These are optional yes?
-				//Encoding:        speechpb.RecognitionConfig_LINEAR16,
-				//SampleRateHertz: 16000,
-				LanguageCode:               *language,
-				EnableAutomaticPunctuation: true,
-				EnableSpeakerDiarization:   true,
-				DiarizationSpeakerCount:    int32(*speakercount),
-//				Model:                      "video",
-				UseEnhanced:                true,
-			},
-			Audio: &speechpb.RecognitionAudio{
-				AudioSource: &speechpb.RecognitionAudio_Uri{Uri: gcsURI},
-			},
-		}
-	}
-
-	op, err := client.LongRunningRecognize(ctx, req)
+	var rec recognizer
+	switch {
+	case *dryrun:
+	case *backend == backendhttp:
+		if *streaming {
+			log.Fatal("the http backend can't stream")
+		}
+		rec = newHTTPRecognizer(*httpendpoint, *httpmodel, os.Getenv(httpkeyenv))
+	case *backend == backendgoogle:
+		grec, err := newGoogleRecognizer(ctx)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer grec.Close()
+		rec = grec
+	default:
+		log.Fatalf("unknown -backend %q, use %s or %s", *backend, backendgoogle, backendhttp)
+	}
+	if *dryrun && *serveaddr != "" {
+		log.Fatal("can't serve jobs in a dry run")
+	}
+
+	if *serveaddr != "" {
+		queue, err := openqueue(*queuedir)
+		if err != nil {
+			log.Fatalf("can't open job queue %s: %v", *queuedir, err)
+		}
+		s := newserver(ctx, rec, profiles, queue, *jobs)
+		log.Printf("serving jobs on %s", *serveaddr)
+		log.Fatal(http.ListenAndServe(*serveaddr, s))
+	}
+
+	if s := runbatch(ctx, rec, shorturis, *jobs); s > status {
+		status = s
+	}
+}
+
+// saveresult writes resp to outputfile as canonical proto JSON,
+// compressed with gzip if outputfile ends in .gz.
+func saveresult(resp *speechpb.LongRunningRecognizeResponse, outputfile string) error {
+	fd, err := os.Create(outputfile)
 	if err != nil {
-		return nil, err
-	}
-
-	for {
-		resp, err := op.Poll(ctx)
-		switch {
-		case err != nil && op.Done():
-			log.Printf("%s: op failed: %v, giving up\n", gcsURI, err)
-			return nil, err
-		case err != nil:
-			log.Printf("%s: poll errored: %v\n", gcsURI, err)
-		case err == nil && !op.Done():
-			log.Printf("%s: not done yet\n", gcsURI)
-		case err == nil && resp != nil && op.Done():
+		return err
+	}
+
+	var w io.Writer = fd
+	var zw *gzip.Writer
+	if strings.HasSuffix(outputfile, ".gz") {
+		zw = gzip.NewWriter(fd)
+		w = zw
+	}
+	marshaler := &jsonpb.Marshaler{}
+	if err := marshaler.Marshal(w, resp); err != nil {
+		fd.Close()
+		return err
+	}
+	if zw != nil {
+		if err := zw.Close(); err != nil {
+			fd.Close()
+			return err
+		}
+	}
+	return fd.Close()
+}
+
+// buildrequest makes the request to transcribe the audio at gcsURI with
+// config.
+func buildrequest(config *speechpb.RecognitionConfig, gcsURI string) *speechpb.LongRunningRecognizeRequest {
+	return &speechpb.LongRunningRecognizeRequest{
+		Config: config,
+		Audio: &speechpb.RecognitionAudio{
+			AudioSource: &speechpb.RecognitionAudio_Uri{Uri: gcsURI},
+		},
+	}
+}
+
+// sendGCS submits the audio at gcsURI for long running recognition with
+// config and polls until the operation has finished. If an operation
+// writing to outputfile was already submitted by an earlier run, sendGCS
+// reattaches to it instead of submitting the audio again.
+func sendGCS(ctx context.Context, rec recognizer, config *speechpb.RecognitionConfig, gcsURI, outputfile string) (*speechpb.LongRunningRecognizeResponse, error) {
+	if p := pending.lookup(outputfile); p != nil && p.URI == gcsURI {
+		log.Printf("%s: reattaching to operation %s submitted %v", gcsURI, p.Name, p.Submitted)
+		resp, err := pollGCS(ctx, rec.Reattach(p.Name), gcsURI, outputfile, p.Submitted)
+		if status.Code(err) != codes.NotFound {
 			return resp, err
 		}
-		waiter := time.NewTimer(time.Second * 120)
-		<-waiter.C
+		// The operation expired or was never known to the server so the
+		// audio has to be submitted again.
+		log.Printf("%s: operation %s is gone, submitting again: %v", gcsURI, p.Name, err)
+		if err := pending.remove(outputfile); err != nil {
+			log.Printf("%s: can't update saved operations: %v", gcsURI, err)
+		}
+	}
+
+	op, err := rec.Submit(ctx, buildrequest(config, gcsURI))
+	if err != nil {
+		return nil, &failure{status: exitfailed, err: err}
+	}
+	submitted := time.Now()
+	if err := pending.add(&pendingop{
+		Name:      op.Name(),
+		URI:       gcsURI,
+		Output:    outputfile,
+		Submitted: submitted,
+	}); err != nil {
+		log.Printf("%s: can't save operation %s: %v", gcsURI, op.Name(), err)
 	}
-	return nil, nil
+	return pollGCS(ctx, op, gcsURI, outputfile, submitted)
 }
@@ -0,0 +1,375 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/ptypes/duration"
+	"golang.org/x/net/context"
+	speechpb "google.golang.org/genproto/googleapis/cloud/speech/v1p1beta1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var cannedresp = &speechpb.LongRunningRecognizeResponse{
+	Results: []*speechpb.SpeechRecognitionResult{
+		{
+			Alternatives: []*speechpb.SpeechRecognitionAlternative{
+				{
+					Transcript: "hello there",
+					Confidence: 0.9,
+					Words: []*speechpb.WordInfo{
+						{
+							Word:       "hello",
+							StartTime:  &duration.Duration{Seconds: 1},
+							EndTime:    &duration.Duration{Seconds: 1, Nanos: 500000000},
+							SpeakerTag: 1,
+						},
+						{
+							Word:       "there",
+							StartTime:  &duration.Duration{Seconds: 2},
+							EndTime:    &duration.Duration{Seconds: 2, Nanos: 400000000},
+							SpeakerTag: 2,
+						},
+					},
+				},
+			},
+		},
+	},
+}
+
+// intempdir runs each test in its own directory with fast polling, a
+// fresh state file and an empty fake GCS. Call the returned function to
+// restore things.
+func intempdir(t *testing.T) func() {
+	dir, err := ioutil.TempDir("", "transcribe")
+	if err != nil {
+		t.Fatal(err)
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	st, err := loadstate(filepath.Join(dir, "state.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pending = st
+	oldinterval := *pollinitial
+	*pollinitial = time.Millisecond
+	_, shutdowngcs := usefakegcs(t)
+
+	return func() {
+		shutdowngcs()
+		*pollinitial = oldinterval
+		pending = nil
+		os.Chdir(wd)
+		os.RemoveAll(dir)
+	}
+}
+
+// readresult reads back a saved transcription.
+func readresult(t *testing.T, fn string) *speechpb.LongRunningRecognizeResponse {
+	resp, err := loadresult(fn)
+	if err != nil {
+		t.Fatalf("can't read result: %v", err)
+	}
+	return resp
+}
+
+// readprovenance reads back a saved provenance sidecar.
+func readprovenance(t *testing.T, fn string) *provenance {
+	buffy, err := ioutil.ReadFile(fn)
+	if err != nil {
+		t.Fatalf("can't read provenance: %v", err)
+	}
+	var prov provenance
+	if err := json.Unmarshal(buffy, &prov); err != nil {
+		t.Fatalf("can't decode provenance %s: %v", fn, err)
+	}
+	return &prov
+}
+
+func TestDotranscribe(t *testing.T) {
+	defer intempdir(t)()
+
+	f := newFakespeech()
+	f.scripts["gs://audioscratch/clip.wav"] = []fakestep{
+		{progress: 10},
+		{pollerr: codes.Unavailable},
+		{progress: 80},
+		{resp: cannedresp},
+	}
+	rec, shutdown := newFakeRecognizer(t, f)
+	defer shutdown()
+
+	if err := dotranscribe(context.Background(), rec, "clip.wav"); err != nil {
+		t.Fatalf("dotranscribe failed: %v", err)
+	}
+
+	if got, want := len(f.submitted), 1; got != want {
+		t.Fatalf("submitted %d requests, want %d", got, want)
+	}
+	if got, want := f.submitted[0].Config.LanguageCode, defaultlang; got != want {
+		t.Errorf("submitted language %q, want %q", got, want)
+	}
+
+	resp := readresult(t, "clip-en-US.json")
+	if got, want := resp.Results[0].Alternatives[0].Transcript, "hello there"; got != want {
+		t.Errorf("saved transcript %q, want %q", got, want)
+	}
+	if got, want := resp.Results[0].Alternatives[0].Words[1].SpeakerTag, int32(2); got != want {
+		t.Errorf("saved speaker tag %d, want %d", got, want)
+	}
+	if p := pending.lookup("clip-en-US.json"); p != nil {
+		t.Errorf("saved operation is still pending: %v", p)
+	}
+
+	// Saved in the canonical proto JSON form.
+	buffy, err := ioutil.ReadFile("clip-en-US.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []byte(`"endTime":"1.500s"`); !bytes.Contains(buffy, want) {
+		t.Errorf("saved %s, want durations like %s", buffy, want)
+	}
+
+	prov := readprovenance(t, "clip-en-US.meta.json")
+	if got, want := prov.Source, "gs://audioscratch/clip.wav"; got != want {
+		t.Errorf("recorded source %q, want %q", got, want)
+	}
+	if got, want := prov.Profile.Name, "default"; got != want {
+		t.Errorf("recorded profile %q, want %q", got, want)
+	}
+	if got, want := prov.Config.LanguageCode, defaultlang; got != want {
+		t.Errorf("recorded language %q, want %q", got, want)
+	}
+	if got, want := prov.Method, methodlongrunning; got != want {
+		t.Errorf("recorded method %q, want %q", got, want)
+	}
+	if prov.Operation == "" || prov.Submitted.IsZero() || prov.Finished.Before(prov.Submitted) {
+		t.Errorf("recorded operation %q from %v to %v", prov.Operation, prov.Submitted, prov.Finished)
+	}
+
+	// A second run skips the finished transcription.
+	if err := dotranscribe(context.Background(), rec, "clip.wav"); err != nil {
+		t.Fatalf("dotranscribe of finished job failed: %v", err)
+	}
+	if got, want := len(f.submitted), 1; got != want {
+		t.Errorf("submitted %d requests, want %d", got, want)
+	}
+
+	// So does one saved before languages were in the names of results.
+	if err := os.Rename("clip-en-US.json", "clip.json"); err != nil {
+		t.Fatal(err)
+	}
+	if err := dotranscribe(context.Background(), rec, "clip.wav"); err != nil {
+		t.Fatalf("dotranscribe of job finished under the legacy name failed: %v", err)
+	}
+	if got, want := len(f.submitted), 1; got != want {
+		t.Errorf("submitted %d requests, want %d", got, want)
+	}
+}
+
+func TestDotranscribeFailure(t *testing.T) {
+	defer intempdir(t)()
+
+	f := newFakespeech()
+	f.scripts["gs://audioscratch/clip.wav"] = []fakestep{
+		{progress: 10},
+		{failure: status.New(codes.InvalidArgument, "bad audio")},
+	}
+	rec, shutdown := newFakeRecognizer(t, f)
+	defer shutdown()
+
+	err := dotranscribe(context.Background(), rec, "clip.wav")
+	if err == nil {
+		t.Fatal("dotranscribe of bad audio succeeded")
+	}
+	if got, want := status.Code(err), codes.InvalidArgument; got != want {
+		t.Errorf("got error %v, want code %v", err, want)
+	}
+	if _, err := os.Stat("clip-en-US.json"); !os.IsNotExist(err) {
+		t.Errorf("failed transcription wrote a result: %v", err)
+	}
+	if p := pending.lookup("clip-en-US.json"); p != nil {
+		t.Errorf("failed operation is still pending: %v", p)
+	}
+
+	// Audio that the server doesn't have fails to submit.
+	if err := dotranscribe(context.Background(), rec, "missing.wav"); err == nil {
+		t.Error("dotranscribe of missing audio succeeded")
+	}
+}
+
+func TestDotranscribeReattach(t *testing.T) {
+	defer intempdir(t)()
+
+	f := newFakespeech()
+	f.addop("operations/earlier", fakestep{progress: 50}, fakestep{resp: cannedresp})
+	rec, shutdown := newFakeRecognizer(t, f)
+	defer shutdown()
+
+	if err := pending.add(&pendingop{
+		Name:      "operations/earlier",
+		URI:       "gs://audioscratch/clip.wav",
+		Output:    "clip-en-US.json",
+		Submitted: time.Now(),
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := dotranscribe(context.Background(), rec, "clip.wav"); err != nil {
+		t.Fatalf("dotranscribe failed: %v", err)
+	}
+	if got := len(f.submitted); got != 0 {
+		t.Errorf("submitted %d requests instead of reattaching", got)
+	}
+	if got, want := readresult(t, "clip-en-US.json").Results[0].Alternatives[0].Transcript, "hello there"; got != want {
+		t.Errorf("saved transcript %q, want %q", got, want)
+	}
+
+	// An operation that the server no longer has is submitted again.
+	f.scripts["gs://audioscratch/other.wav"] = []fakestep{{resp: cannedresp}}
+	if err := pending.add(&pendingop{
+		Name:      "operations/expired",
+		URI:       "gs://audioscratch/other.wav",
+		Output:    "other-en-US.json",
+		Submitted: time.Now(),
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := dotranscribe(context.Background(), rec, "other.wav"); err != nil {
+		t.Fatalf("dotranscribe of expired operation failed: %v", err)
+	}
+	if got := len(f.submitted); got != 1 {
+		t.Errorf("submitted %d requests, want 1", got)
+	}
+	if p := pending.lookup("other-en-US.json"); p != nil {
+		t.Errorf("operation %s is still pending", p.Name)
+	}
+	if got, want := readresult(t, "other-en-US.json").Results[0].Alternatives[0].Transcript, "hello there"; got != want {
+		t.Errorf("saved transcript %q, want %q", got, want)
+	}
+}
+
+func TestDotranscribeGzip(t *testing.T) {
+	defer intempdir(t)()
+	oldcompress := *compress
+	*compress = true
+	defer func() { *compress = oldcompress }()
+
+	f := newFakespeech()
+	f.scripts["gs://audioscratch/clip.wav"] = []fakestep{{resp: cannedresp}}
+	rec, shutdown := newFakeRecognizer(t, f)
+	defer shutdown()
+
+	if err := dotranscribe(context.Background(), rec, "clip.wav"); err != nil {
+		t.Fatalf("dotranscribe failed: %v", err)
+	}
+	if got, want := readresult(t, "clip-en-US.json.gz").Results[0].Alternatives[0].Words[0].Word, "hello"; got != want {
+		t.Errorf("saved word %q, want %q", got, want)
+	}
+	if _, err := os.Stat("clip-en-US.meta.json"); err != nil {
+		t.Errorf("no provenance: %v", err)
+	}
+}
+
+func TestDotranscribeChannels(t *testing.T) {
+	defer intempdir(t)()
+	g, shutdowngcs := usefakegcs(t)
+	defer shutdowngcs()
+	oldchosen := chosen
+	chosen = builtinprofiles["channels"]
+	defer func() { chosen = oldchosen }()
+
+	g.put("audioscratch", "stereo.wav", makewav(16000, 2, time.Minute))
+	g.put("audioscratch", "many.wav", makewav(16000, 9, time.Second))
+	f := newFakespeech()
+	f.scripts["gs://audioscratch/stereo.wav"] = []fakestep{{resp: cannedresp}}
+	rec, shutdown := newFakeRecognizer(t, f)
+	defer shutdown()
+
+	if err := dotranscribe(context.Background(), rec, "stereo.wav"); err != nil {
+		t.Fatalf("dotranscribe failed: %v", err)
+	}
+	config := f.submitted[0].Config
+	if !config.EnableSeparateRecognitionPerChannel || config.AudioChannelCount != 2 {
+		t.Errorf("submitted separate channels %v with %d channels, want 2", config.EnableSeparateRecognitionPerChannel, config.AudioChannelCount)
+	}
+
+	if err := dotranscribe(context.Background(), rec, "many.wav"); err == nil {
+		t.Error("dotranscribe of 9 channels succeeded")
+	}
+}
+
+func TestOutputname(t *testing.T) {
+	oldlang, oldalt := *language, *altlanguages
+	defer func() { *language, *altlanguages = oldlang, oldalt }()
+
+	tt := []struct {
+		shorturi string
+		lang     string
+		alt      string
+		want     string
+		legacy   string
+	}{
+		{"clip.wav", "en-US", "", "clip-en-US.json", "clip.json"},
+		{"clip-<1>.wav", "en-AU", "", "clip-<1>-en-AU.json", ""},
+		{"clip.flac", "en-US", "en-AU, fr-CA", "clip-en-US+en-AU+fr-CA.json", ""},
+	}
+	for _, tv := range tt {
+		*language, *altlanguages = tv.lang, tv.alt
+		if got := outputname(tv.shorturi); got != tv.want {
+			t.Errorf("%s in %s,%s: got %s, want %s", tv.shorturi, tv.lang, tv.alt, got, tv.want)
+		}
+		if got := legacyname(outputname(tv.shorturi)); got != tv.legacy {
+			t.Errorf("%s in %s,%s: got legacy name %q, want %q", tv.shorturi, tv.lang, tv.alt, got, tv.legacy)
+		}
+	}
+}
+
+func TestDotranscribeAltLanguages(t *testing.T) {
+	defer intempdir(t)()
+	oldalt := *altlanguages
+	*altlanguages = "fr-CA"
+	defer func() { *altlanguages = oldalt }()
+
+	// The API found some French.
+	french := &speechpb.LongRunningRecognizeResponse{
+		Results: []*speechpb.SpeechRecognitionResult{
+			cannedresp.Results[0],
+			{
+				Alternatives: []*speechpb.SpeechRecognitionAlternative{{Transcript: "bonjour"}},
+				LanguageCode: "fr-ca",
+			},
+		},
+	}
+	f := newFakespeech()
+	f.scripts["gs://audioscratch/clip.wav"] = []fakestep{{resp: french}}
+	rec, shutdown := newFakeRecognizer(t, f)
+	defer shutdown()
+
+	if err := dotranscribe(context.Background(), rec, "clip.wav"); err != nil {
+		t.Fatalf("dotranscribe failed: %v", err)
+	}
+	if got := f.submitted[0].Config.AlternativeLanguageCodes; len(got) != 1 || got[0] != "fr-CA" {
+		t.Errorf("submitted alternative languages %v, want [fr-CA]", got)
+	}
+
+	resp := readresult(t, "clip-en-US+fr-CA.json")
+	for i, want := range []string{"en-US", "fr-ca"} {
+		if got := resp.Results[i].LanguageCode; got != want {
+			t.Errorf("result %d: saved language %q, want %q", i, got, want)
+		}
+	}
+}
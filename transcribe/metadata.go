@@ -0,0 +1,128 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/golang/protobuf/proto"
+	speechpb "google.golang.org/genproto/googleapis/cloud/speech/v1p1beta1"
+)
+
+// Files in a project directory describing its recordings.
+const (
+	metadataname = "metadata.json"
+	manifestname = "manifest.json"
+)
+
+// maxnaicscode is the largest 6 digit NAICS industry code.
+const maxnaicscode = 999999
+
+// projectmetadata describes every recording in the project.
+var projectmetadata *speechpb.RecognitionMetadata
+
+// manifest holds the descriptions of individual recordings that
+// override projectmetadata.
+var manifest map[string]*speechpb.RecognitionMetadata
+
+// parsemetadata decodes the RecognitionMetadata in proto JSON form in
+// buffy. Misspelled fields and values are errors.
+func parsemetadata(buffy []byte) (*speechpb.RecognitionMetadata, error) {
+	var md speechpb.RecognitionMetadata
+	if err := jsonpb.UnmarshalString(string(buffy), &md); err != nil {
+		return nil, err
+	}
+	if md.IndustryNaicsCodeOfAudio > maxnaicscode {
+		return nil, fmt.Errorf("industry code %d is not a 6 digit NAICS code", md.IndustryNaicsCodeOfAudio)
+	}
+	return &md, nil
+}
+
+// readmetadata reads the project metadata file fn, a RecognitionMetadata
+// in JSON like {"interaction_type": "DISCUSSION"}.
+func readmetadata(fn string) (*speechpb.RecognitionMetadata, error) {
+	buffy, err := ioutil.ReadFile(fn)
+	if err != nil {
+		return nil, err
+	}
+	md, err := parsemetadata(buffy)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", fn, err)
+	}
+	return md, nil
+}
+
+// readmanifest reads the manifest file fn. It is a JSON object mapping
+// the name of each recording to the metadata that differs from the
+// project's.
+func readmanifest(fn string) (map[string]*speechpb.RecognitionMetadata, error) {
+	buffy, err := ioutil.ReadFile(fn)
+	if err != nil {
+		return nil, err
+	}
+	entries := make(map[string]json.RawMessage)
+	if err := json.Unmarshal(buffy, &entries); err != nil {
+		return nil, fmt.Errorf("%s: %v", fn, err)
+	}
+	mf := make(map[string]*speechpb.RecognitionMetadata, len(entries))
+	for name, raw := range entries {
+		md, err := parsemetadata(raw)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s: %v", fn, name, err)
+		}
+		mf[name] = md
+	}
+	return mf, nil
+}
+
+// loadprojectmetadata reads the project's metadata and manifest from
+// dir. Either may be missing.
+func loadprojectmetadata(dir string) error {
+	md, err := readmetadata(filepath.Join(dir, metadataname))
+	switch {
+	case err == nil:
+		projectmetadata = md
+	case !os.IsNotExist(err):
+		return err
+	}
+	mf, err := readmanifest(filepath.Join(dir, manifestname))
+	switch {
+	case err == nil:
+		manifest = mf
+	case !os.IsNotExist(err):
+		return err
+	}
+	return nil
+}
+
+// metadatafor returns the metadata for the audio at uri: the project
+// metadata with the manifest entry for the audio merged over it. The
+// manifest entry can be named by the object name in the -ub bucket
+// path, the base name or the whole URI. Returns nil if there is no
+// metadata.
+func metadatafor(uri string) *speechpb.RecognitionMetadata {
+	var entry *speechpb.RecognitionMetadata
+	for _, name := range []string{strings.TrimPrefix(uri, *uribase+"/"), path.Base(uri), uri} {
+		if md, ok := manifest[name]; ok {
+			entry = md
+			break
+		}
+	}
+	if projectmetadata == nil && entry == nil {
+		return nil
+	}
+
+	md := new(speechpb.RecognitionMetadata)
+	if projectmetadata != nil {
+		proto.Merge(md, projectmetadata)
+	}
+	if entry != nil {
+		proto.Merge(md, entry)
+	}
+	return md
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"io/ioutil"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"golang.org/x/net/context"
+	speechpb "google.golang.org/genproto/googleapis/cloud/speech/v1p1beta1"
+)
+
+func TestLoadprojectmetadata(t *testing.T) {
+	defer intempdir(t)()
+	defer func() {
+		projectmetadata = nil
+		manifest = nil
+	}()
+
+	if err := loadprojectmetadata("."); err != nil || projectmetadata != nil || manifest != nil {
+		t.Fatalf("project without metadata gave %v, %v, %v", projectmetadata, manifest, err)
+	}
+	if got := metadatafor("gs://audioscratch/clip.wav"); got != nil {
+		t.Errorf("project without metadata gave %v", got)
+	}
+
+	for _, bad := range []string{
+		`{"interaction_type": "CHAT"}`,
+		`{"microphone": "FARFIELD"}`,
+		`{"industry_naics_code_of_audio": 1234567}`,
+	} {
+		if err := ioutil.WriteFile(metadataname, []byte(bad), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := loadprojectmetadata("."); err == nil {
+			t.Errorf("loaded bad metadata %s", bad)
+		}
+	}
+
+	if err := ioutil.WriteFile(metadataname, []byte(`{
+		"interaction_type": "DISCUSSION",
+		"microphone_distance": "MIDFIELD",
+		"originalMediaType": "VIDEO",
+		"industry_naics_code_of_audio": 813410
+	}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(manifestname, []byte(`{
+		"outside.wav": {"microphone_distance": "FARFIELD", "recording_device_type": "SMARTPHONE"},
+		"gs://other/talk.wav": {"interaction_type": "PRESENTATION"}
+	}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := loadprojectmetadata("."); err != nil {
+		t.Fatal(err)
+	}
+
+	project := &speechpb.RecognitionMetadata{
+		InteractionType:          speechpb.RecognitionMetadata_DISCUSSION,
+		MicrophoneDistance:       speechpb.RecognitionMetadata_MIDFIELD,
+		OriginalMediaType:        speechpb.RecognitionMetadata_VIDEO,
+		IndustryNaicsCodeOfAudio: 813410,
+	}
+	outside := proto.Clone(project).(*speechpb.RecognitionMetadata)
+	outside.MicrophoneDistance = speechpb.RecognitionMetadata_FARFIELD
+	outside.RecordingDeviceType = speechpb.RecognitionMetadata_SMARTPHONE
+	talk := proto.Clone(project).(*speechpb.RecognitionMetadata)
+	talk.InteractionType = speechpb.RecognitionMetadata_PRESENTATION
+
+	for uri, want := range map[string]*speechpb.RecognitionMetadata{
+		"gs://audioscratch/clip.wav":         project,
+		"gs://audioscratch/outside.wav":      outside,
+		"gs://audioscratch/day2/outside.wav": outside,
+		"gs://other/talk.wav":                talk,
+		"gs://audioscratch/talk.wav":         project,
+	} {
+		if got := metadatafor(uri); !proto.Equal(got, want) {
+			t.Errorf("%s: got %v, want %v", uri, got, want)
+		}
+	}
+	if !proto.Equal(projectmetadata, project) {
+		t.Errorf("merging changed the project metadata to %v", projectmetadata)
+	}
+
+	f := newFakespeech()
+	f.scripts["gs://audioscratch/outside.wav"] = []fakestep{{resp: cannedresp}}
+	rec, shutdown := newFakeRecognizer(t, f)
+	defer shutdown()
+	if err := dotranscribe(context.Background(), rec, "outside.wav"); err != nil {
+		t.Fatalf("dotranscribe failed: %v", err)
+	}
+	if got := f.submitted[0].Config.Metadata; !proto.Equal(got, outside) {
+		t.Errorf("submitted metadata %v, want %v", got, outside)
+	}
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"golang.org/x/net/context"
+	speechpb "google.golang.org/genproto/googleapis/cloud/speech/v1p1beta1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Exit statuses for each kind of failure. A batch exits with the
+// largest status of its failed transcriptions.
+const (
+	exitok      = 0
+	exitsetup   = 1 // Bad arguments or settings. Nothing was transcribed.
+	exiterror   = 3 // Local or GCS problems such as not being able to save the result.
+	exitfailed  = 4 // The API rejected the audio or the operation failed.
+	exittimeout = 5 // The operation didn't finish within -maxwait.
+	exitretries = 6 // Polling the operation failed more than -retries times.
+	exitbudget  = 7 // The audio would have taken the estimated cost over -budget.
+)
+
+// failure is an error that says how transcribe should exit.
+type failure struct {
+	status int
+	err    error
+}
+
+func (f *failure) Error() string {
+	return f.err.Error()
+}
+
+// GRPCStatus lets status.Code see the API error inside a failure.
+func (f *failure) GRPCStatus() *status.Status {
+	return status.Convert(f.err)
+}
+
+// exitstatus returns the exit status for err.
+func exitstatus(err error) int {
+	if f, ok := err.(*failure); ok {
+		return f.status
+	}
+	return exiterror
+}
+
+// istransient returns true if a poll that failed with err is worth
+// trying again.
+func istransient(err error) bool {
+	switch status.Code(err) {
+	case codes.Unavailable, codes.DeadlineExceeded, codes.ResourceExhausted, codes.Aborted, codes.Internal, codes.Unknown:
+		return true
+	}
+	return false
+}
+
+// nextinterval backs off the poll interval by doubling it up to
+// -pollmax.
+func nextinterval(interval time.Duration) time.Duration {
+	interval *= 2
+	if interval > *pollmax {
+		interval = *pollmax
+	}
+	return interval
+}
+
+// pollGCS polls op until it has finished, backing off between polls.
+// A failed operation stops being pending. A successful one stays
+// pending until its result has been saved. One that is abandoned
+// because it took too long or couldn't be polled also stays pending so
+// that a later run can pick it up again.
+func pollGCS(ctx context.Context, op operation, gcsURI, outputfile string, submitted time.Time) (*speechpb.LongRunningRecognizeResponse, error) {
+	interval := *pollinitial
+	transients := 0
+	for {
+		resp, err := op.Poll(ctx)
+		switch {
+		case err != nil && op.Done():
+			log.Printf("%s: op failed: %v, giving up\n", gcsURI, err)
+			if err := pending.remove(outputfile); err != nil {
+				log.Printf("%s: can't update saved operations: %v", gcsURI, err)
+			}
+			return nil, &failure{status: exitfailed, err: err}
+		case err != nil && !istransient(err):
+			log.Printf("%s: poll failed: %v, giving up\n", gcsURI, err)
+			return nil, &failure{status: exitfailed, err: err}
+		case err != nil:
+			transients++
+			log.Printf("%s: poll errored (%d of %d): %v\n", gcsURI, transients, *retries, err)
+			if transients > *retries {
+				return nil, &failure{
+					status: exitretries,
+					err:    fmt.Errorf("gave up after %d poll errors, the last was %v", transients, err),
+				}
+			}
+		case !op.Done():
+			if md, err := op.Metadata(); err == nil && md != nil {
+				log.Printf("%s: not done yet, %d%% complete\n", gcsURI, md.ProgressPercent)
+			} else {
+				log.Printf("%s: not done yet\n", gcsURI)
+			}
+		case resp == nil:
+			return nil, &failure{status: exitfailed, err: fmt.Errorf("operation %s finished without a result", op.Name())}
+		default:
+			return resp, nil
+		}
+
+		if *maxwait > 0 && time.Since(submitted)+interval > *maxwait {
+			return nil, &failure{
+				status: exittimeout,
+				err:    fmt.Errorf("operation %s not done %v after it was submitted", op.Name(), *maxwait),
+			}
+		}
+		waiter := time.NewTimer(interval)
+		<-waiter.C
+		interval = nextinterval(interval)
+	}
+}
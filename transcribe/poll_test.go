@@ -0,0 +1,68 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+)
+
+func TestNextinterval(t *testing.T) {
+	oldmax := *pollmax
+	*pollmax = 5 * time.Minute
+	defer func() { *pollmax = oldmax }()
+
+	interval := 30 * time.Second
+	for _, want := range []time.Duration{time.Minute, 2 * time.Minute, 4 * time.Minute, 5 * time.Minute, 5 * time.Minute} {
+		interval = nextinterval(interval)
+		if interval != want {
+			t.Errorf("got %v, want %v", interval, want)
+		}
+	}
+}
+
+func TestPollGCS(t *testing.T) {
+	defer intempdir(t)()
+	oldwait, oldretries := *maxwait, *retries
+	defer func() { *maxwait, *retries = oldwait, oldretries }()
+	*retries = 2
+
+	f := newFakespeech()
+	f.addop("operations/slow", fakestep{progress: 10})
+	f.addop("operations/flaky", fakestep{pollerr: codes.ResourceExhausted})
+	f.addop("operations/recovers", fakestep{pollerr: codes.ResourceExhausted}, fakestep{pollerr: codes.Aborted}, fakestep{resp: cannedresp})
+	f.addop("operations/denied", fakestep{pollerr: codes.PermissionDenied})
+	rec, shutdown := newFakeRecognizer(t, f)
+	defer shutdown()
+
+	tt := []struct {
+		name    string
+		maxwait time.Duration
+		status  int
+	}{
+		{"operations/slow", 20 * time.Millisecond, exittimeout},
+		{"operations/flaky", 0, exitretries},
+		{"operations/recovers", 0, exitok},
+		{"operations/denied", 0, exitfailed},
+	}
+	for _, tv := range tt {
+		*maxwait = tv.maxwait
+		if err := pending.add(&pendingop{Name: tv.name, URI: "gs://audioscratch/clip.wav", Output: "clip-en-US.json"}); err != nil {
+			t.Fatal(err)
+		}
+
+		resp, err := pollGCS(context.Background(), rec.Reattach(tv.name), "gs://audioscratch/clip.wav", "clip-en-US.json", time.Now())
+		if got := exitstatus(err); err != nil && got != tv.status || err == nil && tv.status != exitok {
+			t.Errorf("%s: got error %v (status %d), want status %d", tv.name, err, got, tv.status)
+		}
+		if tv.status == exitok && resp == nil {
+			t.Errorf("%s: no result", tv.name)
+		}
+
+		// Operations that might still finish stay pending.
+		if p := pending.lookup("clip-en-US.json"); p == nil {
+			t.Errorf("%s: no longer pending", tv.name)
+		}
+	}
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+
+	speechpb "google.golang.org/genproto/googleapis/cloud/speech/v1p1beta1"
+)
+
+// profile is a named set of recognition features. Profiles are read
+// from a JSON file mapping each name to its features.
+type profile struct {
+	Name            string `json:"name"`
+	Model           string `json:"model,omitempty"`
+	UseEnhanced     bool   `json:"use_enhanced"`
+	Punctuation     bool   `json:"punctuation"`
+	WordTimeOffsets bool   `json:"word_time_offsets"`
+	WordConfidence  bool   `json:"word_confidence"`
+	MaxAlternatives int    `json:"max_alternatives,omitempty"`
+	ProfanityFilter bool   `json:"profanity_filter"`
+	Diarization     bool   `json:"diarization"`
+
+	// SeparateChannels recognizes each channel of multi-channel audio
+	// on its own, e.g. for recordings with one mic per person.
+	SeparateChannels bool `json:"separate_channels"`
+}
+
+// maxalternatives is the most hypotheses the API will return for each
+// result.
+const maxalternatives = 30
+
+// builtinprofiles are always available. default and diarize match what
+// transcribe did before it had profiles.
+var builtinprofiles = map[string]*profile{
+	"default": {Name: "default"},
+	"diarize": {
+		Name:        "diarize",
+		UseEnhanced: true,
+		Punctuation: true,
+		Diarization: true,
+	},
+	"video": {
+		Name:        "video",
+		Model:       "video",
+		UseEnhanced: true,
+		Punctuation: true,
+		Diarization: true,
+	},
+	"channels": {
+		Name:             "channels",
+		Punctuation:      true,
+		WordTimeOffsets:  true,
+		SeparateChannels: true,
+	},
+}
+
+// readprofiles reads the profiles in the JSON file fn. They are added
+// to (and can replace) the built in ones.
+func readprofiles(fn string) (map[string]*profile, error) {
+	profiles := make(map[string]*profile, len(builtinprofiles))
+	for n, p := range builtinprofiles {
+		np := *p
+		profiles[n] = &np
+	}
+	if fn == "" {
+		return profiles, nil
+	}
+
+	buffy, err := ioutil.ReadFile(fn)
+	if err != nil {
+		return nil, err
+	}
+	fromfile := make(map[string]*profile)
+	if err := json.Unmarshal(buffy, &fromfile); err != nil {
+		return nil, fmt.Errorf("%s: %v", fn, err)
+	}
+	for n, p := range fromfile {
+		if p.MaxAlternatives < 0 || p.MaxAlternatives > maxalternatives {
+			return nil, fmt.Errorf("%s: profile %s: max_alternatives must be between 0 and %d", fn, n, maxalternatives)
+		}
+		p.Name = n
+		profiles[n] = p
+	}
+	return profiles, nil
+}
+
+// pickprofile returns the profile called name. With no name, the choice
+// depends on the speaker count to match what transcribe did before it
+// had profiles.
+func pickprofile(profiles map[string]*profile, name string, speakers int) (*profile, error) {
+	if name == "" {
+		name = "default"
+		if speakers != 1 {
+			name = "diarize"
+		}
+	}
+	p, ok := profiles[name]
+	if !ok {
+		names := make([]string, 0, len(profiles))
+		for n := range profiles {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		return nil, fmt.Errorf("no profile %q, try one of %s", name, strings.Join(names, ", "))
+	}
+	return p, nil
+}
+
+// withextras returns a copy of p that also asks for word confidence if
+// wordconfidence is set and for alternatives hypotheses if that is more
+// than 0.
+func (p *profile) withextras(wordconfidence bool, alternatives int) (*profile, error) {
+	if alternatives < 0 || alternatives > maxalternatives {
+		return nil, fmt.Errorf("alternatives must be between 0 and %d", maxalternatives)
+	}
+	np := *p
+	np.WordConfidence = np.WordConfidence || wordconfidence
+	if alternatives > 0 {
+		np.MaxAlternatives = alternatives
+	}
+	return &np, nil
+}
+
+// chosen is the profile used for every transcription.
+var chosen *profile
+
+// activeprofile returns the chosen profile or the one that would be
+// picked by default if there isn't one.
+func activeprofile() *profile {
+	if chosen != nil {
+		return chosen
+	}
+	p, _ := pickprofile(builtinprofiles, "", *speakercount)
+	return p
+}
+
+// config makes the recognition configuration described by the profile.
+func (p *profile) config(language string, speakers int) *speechpb.RecognitionConfig {
+	config := &speechpb.RecognitionConfig{
+		// The encoding and sample rate are in the headers of the WAV and FLAC
+		// files that transcribe sends.
+		LanguageCode:               language,
+		Model:                      p.Model,
+		UseEnhanced:                p.UseEnhanced,
+		EnableAutomaticPunctuation: p.Punctuation,
+		EnableWordTimeOffsets:      p.WordTimeOffsets,
+		EnableWordConfidence:       p.WordConfidence,
+		MaxAlternatives:            int32(p.MaxAlternatives),
+		ProfanityFilter:            p.ProfanityFilter,
+	}
+	if p.Diarization {
+		config.EnableSpeakerDiarization = true
+		config.DiarizationSpeakerCount = int32(speakers)
+	}
+	// The channel count comes from the audio. See setchannels.
+	config.EnableSeparateRecognitionPerChannel = p.SeparateChannels
+	return config
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	speechpb "google.golang.org/genproto/googleapis/cloud/speech/v1p1beta1"
+)
+
+func TestReadprofiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "transcribe")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	fn := filepath.Join(dir, "profiles.json")
+	if err := ioutil.WriteFile(fn, []byte(`{
+	"interview": {"model": "video", "use_enhanced": true, "punctuation": true, "diarization": true, "word_confidence": true, "max_alternatives": 3},
+	"default": {"punctuation": true}
+}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	profiles, err := readprofiles(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := pickprofile(profiles, "interview", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &speechpb.RecognitionConfig{
+		LanguageCode:               "en-AU",
+		Model:                      "video",
+		UseEnhanced:                true,
+		EnableAutomaticPunctuation: true,
+		EnableWordConfidence:       true,
+		MaxAlternatives:            3,
+		EnableSpeakerDiarization:   true,
+		DiarizationSpeakerCount:    2,
+	}
+	if got := p.config("en-AU", 2); !proto.Equal(got, want) {
+		t.Errorf("got config %v, want %v", got, want)
+	}
+
+	// The file replaces a built in profile but leaves the others alone.
+	if p, _ := pickprofile(profiles, "", 1); p.Name != "default" || !p.Punctuation {
+		t.Errorf("default profile is %+v", p)
+	}
+	if p, _ := pickprofile(profiles, "", 3); p.Name != "diarize" || !p.Diarization {
+		t.Errorf("diarize profile is %+v", p)
+	}
+	if _, err := pickprofile(profiles, "podcast", 1); err == nil {
+		t.Error("picked a profile that doesn't exist")
+	}
+
+	if err := ioutil.WriteFile(fn, []byte(`{"greedy": {"max_alternatives": 50}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := readprofiles(fn); err == nil {
+		t.Error("read a profile with too many alternatives")
+	}
+}
+
+func TestBuiltinProfilesMatchOldConfigs(t *testing.T) {
+	p, _ := pickprofile(builtinprofiles, "", 1)
+	if got, want := p.config("en-US", 1), (&speechpb.RecognitionConfig{LanguageCode: "en-US"}); !proto.Equal(got, want) {
+		t.Errorf("one speaker: got %v, want %v", got, want)
+	}
+
+	p, _ = pickprofile(builtinprofiles, "", 4)
+	want := &speechpb.RecognitionConfig{
+		LanguageCode:               "en-US",
+		EnableAutomaticPunctuation: true,
+		EnableSpeakerDiarization:   true,
+		DiarizationSpeakerCount:    4,
+		UseEnhanced:                true,
+	}
+	if got := p.config("en-US", 4); !proto.Equal(got, want) {
+		t.Errorf("four speakers: got %v, want %v", got, want)
+	}
+}
+
+func TestWithextras(t *testing.T) {
+	p, err := builtinprofiles["video"].withextras(true, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !p.WordConfidence || p.MaxAlternatives != 5 || p.Model != "video" {
+		t.Errorf("got %+v, want video with word confidence and 5 alternatives", p)
+	}
+	if builtinprofiles["video"].WordConfidence {
+		t.Error("withextras changed the builtin profile")
+	}
+	config := p.config("en-US", 1)
+	if !config.EnableWordConfidence || config.MaxAlternatives != 5 {
+		t.Errorf("config %v doesn't ask for word confidence and 5 alternatives", config)
+	}
+
+	if _, err := builtinprofiles["default"].withextras(false, 31); err == nil {
+		t.Error("withextras accepted 31 alternatives")
+	}
+}
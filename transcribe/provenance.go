@@ -0,0 +1,99 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"runtime/debug"
+	"time"
+
+	"golang.org/x/net/context"
+	speechpb "google.golang.org/genproto/googleapis/cloud/speech/v1p1beta1"
+)
+
+// version is the version of transcribe recorded with each result. Set
+// it with -ldflags "-X main.version=...". Otherwise the module version
+// is used.
+var version = ""
+
+// toolversion returns the version of transcribe.
+func toolversion() string {
+	if version != "" {
+		return version
+	}
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		return bi.Main.Version
+	}
+	return "unknown"
+}
+
+// Ways that the audio is sent to the API.
+const (
+	methodlongrunning = "longrunning"
+	methodinline      = "inline"
+	methodstreaming   = "streaming"
+)
+
+// provenance records how a transcription was made. It is saved in a
+// sidecar file next to the result.
+type provenance struct {
+	Source    string                      `json:"source"`
+	Local     string                      `json:"local,omitempty"`
+	MD5       string                      `json:"md5,omitempty"`
+	Speakers  int                         `json:"speakers"`
+	Profile   *profile                    `json:"profile"`
+	Config    *speechpb.RecognitionConfig `json:"config"`
+	Method    string                      `json:"method"`
+	Backend   string                      `json:"backend,omitempty"`
+	Operation string                      `json:"operation,omitempty"`
+	Submitted time.Time                   `json:"submitted"`
+	Finished  time.Time                   `json:"finished"`
+	Version   string                      `json:"version"`
+}
+
+// metaname is the name of the provenance sidecar of outputfile.
+func metaname(outputfile string) string {
+	return resultbase(outputfile) + ".meta.json"
+}
+
+// audiomd5 returns the hex MD5 checksum of the audio, computing it for
+// a local file or asking GCS for it otherwise.
+func audiomd5(ctx context.Context, localpath, gcsURI string) (string, error) {
+	if localpath != "" {
+		sum, err := filemd5(localpath)
+		if err != nil {
+			return "", err
+		}
+		return hex.EncodeToString(sum), nil
+	}
+
+	bucket, name, err := splitgcsuri(gcsURI)
+	if err != nil {
+		return "", err
+	}
+	client, err := storageclient(ctx)
+	if err != nil {
+		return "", err
+	}
+	attrs, err := client.Bucket(bucket).Object(name).Attrs(ctx)
+	if err != nil {
+		return "", fmt.Errorf("%s: %v", gcsURI, err)
+	}
+	return hex.EncodeToString(attrs.MD5), nil
+}
+
+// writeprovenance saves prov in the sidecar of outputfile.
+func writeprovenance(prov *provenance, outputfile string) error {
+	fd, err := os.Create(metaname(outputfile))
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(fd)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(prov); err != nil {
+		fd.Close()
+		return err
+	}
+	return fd.Close()
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// The states of a queued job.
+const (
+	jobqueued  = "queued"
+	jobrunning = "running"
+	jobdone    = "done"
+	jobfailed  = "failed"
+)
+
+// queuedjob is a transcription submitted to the server.
+type queuedjob struct {
+	ID       string    `json:"id"`
+	URI      string    `json:"uri"`
+	Profile  string    `json:"profile"`
+	Speakers int       `json:"speakers"`
+	State    string    `json:"state"`
+	Error    string    `json:"error,omitempty"`
+	Output   string    `json:"output"`
+	Created  time.Time `json:"created"`
+	Started  time.Time `json:"started,omitempty"`
+	Finished time.Time `json:"finished,omitempty"`
+}
+
+// queuename is the file in the queue directory listing the jobs.
+const queuename = "queue.json"
+
+// jobqueue is the server's jobs, keyed by ID. They are saved to the
+// queue directory each time they change. The results are written to the
+// same directory.
+type jobqueue struct {
+	mu   sync.Mutex
+	dir  string
+	jobs map[string]*queuedjob
+}
+
+// openqueue reads the jobs saved in the directory dir, making it if
+// needed.
+func openqueue(dir string) (*jobqueue, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	q := &jobqueue{
+		dir:  dir,
+		jobs: make(map[string]*queuedjob),
+	}
+
+	buffy, err := ioutil.ReadFile(filepath.Join(dir, queuename))
+	if os.IsNotExist(err) {
+		return q, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	jobs := make([]*queuedjob, 0)
+	if err := json.Unmarshal(buffy, &jobs); err != nil {
+		return nil, err
+	}
+	for _, j := range jobs {
+		q.jobs[j.ID] = j
+	}
+	return q, nil
+}
+
+// newjobid makes a random job ID.
+func newjobid() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// add queues a new job to transcribe the audio at uri with the profile
+// called profile.
+func (q *jobqueue) add(uri, profile string, speakers int) (*queuedjob, error) {
+	id, err := newjobid()
+	if err != nil {
+		return nil, err
+	}
+	j := &queuedjob{
+		ID:       id,
+		URI:      uri,
+		Profile:  profile,
+		Speakers: speakers,
+		State:    jobqueued,
+		Output:   filepath.Join(q.dir, outputname(id)),
+		Created:  time.Now(),
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.jobs[id] = j
+	nj := *j
+	return &nj, q.save()
+}
+
+// get returns a copy of the job with id or nil if there isn't one.
+func (q *jobqueue) get(id string) *queuedjob {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	j, ok := q.jobs[id]
+	if !ok {
+		return nil
+	}
+	nj := *j
+	return &nj
+}
+
+// list returns copies of the jobs, oldest first.
+func (q *jobqueue) list() []*queuedjob {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	jobs := make([]*queuedjob, 0, len(q.jobs))
+	for _, j := range q.jobs {
+		nj := *j
+		jobs = append(jobs, &nj)
+	}
+	sort.Slice(jobs, func(i, k int) bool {
+		if jobs[i].Created.Equal(jobs[k].Created) {
+			return jobs[i].ID < jobs[k].ID
+		}
+		return jobs[i].Created.Before(jobs[k].Created)
+	})
+	return jobs
+}
+
+// setstate moves the job with id to state. err is why a job failed.
+func (q *jobqueue) setstate(id, state string, err error) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	j, ok := q.jobs[id]
+	if !ok {
+		return fmt.Errorf("no job %s", id)
+	}
+	j.State = state
+	j.Error = ""
+	if err != nil {
+		j.Error = err.Error()
+	}
+	switch state {
+	case jobrunning:
+		j.Started = time.Now()
+	case jobdone, jobfailed:
+		j.Finished = time.Now()
+	}
+	return q.save()
+}
+
+// save writes the jobs to the queue file. Call with q.mu held.
+func (q *jobqueue) save() error {
+	jobs := make([]*queuedjob, 0, len(q.jobs))
+	for _, j := range q.jobs {
+		jobs = append(jobs, j)
+	}
+	buffy, err := json.MarshalIndent(jobs, "", "\t")
+	if err != nil {
+		return err
+	}
+	return writeatomic(filepath.Join(q.dir, queuename), buffy)
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"github.com/googleapis/gax-go/v2"
+	"golang.org/x/net/context"
+
+	speech "cloud.google.com/go/speech/apiv1p1beta1"
+	"google.golang.org/api/option"
+	speechpb "google.golang.org/genproto/googleapis/cloud/speech/v1p1beta1"
+	"google.golang.org/grpc"
+)
+
+// recognizer is a speech recognition backend that transcribes short
+// audio immediately and longer audio with long running operations.
+type recognizer interface {
+	// Recognize transcribes the short audio in req immediately.
+	Recognize(ctx context.Context, req *speechpb.RecognizeRequest) (*speechpb.RecognizeResponse, error)
+
+	// Stream opens a stream for streaming recognition.
+	Stream(ctx context.Context) (speechpb.Speech_StreamingRecognizeClient, error)
+
+	// Submit starts the transcription described by req.
+	Submit(ctx context.Context, req *speechpb.LongRunningRecognizeRequest) (operation, error)
+
+	// Reattach finds the already submitted operation called name.
+	Reattach(name string) operation
+
+	// Close releases the resources held by the recognizer.
+	Close() error
+}
+
+// operation is a submitted transcription. It has the same methods as
+// speech.LongRunningRecognizeOperation.
+type operation interface {
+	Name() string
+	Done() bool
+	Poll(ctx context.Context, opts ...gax.CallOption) (*speechpb.LongRunningRecognizeResponse, error)
+	Metadata() (*speechpb.LongRunningRecognizeMetadata, error)
+}
+
+// googlerecognizer transcribes with the Google Speech API.
+type googlerecognizer struct {
+	client *speech.Client
+}
+
+// newGoogleRecognizer makes a recognizer using the Google Speech API.
+// opts are added to the default options. A single recognizer can be
+// shared by all of the jobs in a batch.
+func newGoogleRecognizer(ctx context.Context, opts ...option.ClientOption) (*googlerecognizer, error) {
+	opts = append([]option.ClientOption{
+		option.WithGRPCDialOption(grpc.WithDefaultCallOptions(grpc.MaxCallRecvMsgSize(1 << 30))),
+	}, opts...)
+	client, err := speech.NewClient(ctx, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &googlerecognizer{client: client}, nil
+}
+
+func (g *googlerecognizer) Recognize(ctx context.Context, req *speechpb.RecognizeRequest) (*speechpb.RecognizeResponse, error) {
+	return g.client.Recognize(ctx, req)
+}
+
+func (g *googlerecognizer) Stream(ctx context.Context) (speechpb.Speech_StreamingRecognizeClient, error) {
+	return g.client.StreamingRecognize(ctx)
+}
+
+func (g *googlerecognizer) Submit(ctx context.Context, req *speechpb.LongRunningRecognizeRequest) (operation, error) {
+	op, err := g.client.LongRunningRecognize(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return op, nil
+}
+
+func (g *googlerecognizer) Reattach(name string) operation {
+	return g.client.LongRunningRecognizeOperation(name)
+}
+
+func (g *googlerecognizer) Close() error {
+	return g.client.Close()
+}
@@ -0,0 +1,268 @@
+package main
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/gammazero/workerpool"
+	"github.com/golang/protobuf/jsonpb"
+	"golang.org/x/net/context"
+	speechpb "google.golang.org/genproto/googleapis/cloud/speech/v1p1beta1"
+)
+
+// server runs the jobs submitted over HTTP.
+type server struct {
+	ctx      context.Context
+	rec      recognizer
+	profiles map[string]*profile
+	queue    *jobqueue
+	wp       *workerpool.WorkerPool
+}
+
+// newserver makes a server running the jobs in queue with at most jobs
+// of them in flight at once. Jobs left unfinished by an earlier server
+// are started again.
+func newserver(ctx context.Context, rec recognizer, profiles map[string]*profile, queue *jobqueue, jobs int) *server {
+	if jobs < 1 {
+		jobs = 1
+	}
+	s := &server{
+		ctx:      ctx,
+		rec:      rec,
+		profiles: profiles,
+		queue:    queue,
+		wp:       workerpool.New(jobs),
+	}
+	for _, j := range queue.list() {
+		if j.State == jobqueued || j.State == jobrunning {
+			log.Printf("job %s: resuming %s", j.ID, j.URI)
+			s.dispatch(j)
+		}
+	}
+	return s
+}
+
+// dispatch runs j once there is room.
+func (s *server) dispatch(j *queuedjob) {
+	s.wp.Submit(func() {
+		if err := s.queue.setstate(j.ID, jobrunning, nil); err != nil {
+			log.Printf("job %s: can't save state: %v", j.ID, err)
+		}
+		err := s.run(j)
+		state := jobdone
+		if err != nil {
+			log.Printf("job %s: transcription failed: %v", j.ID, err)
+			state = jobfailed
+		}
+		if err := s.queue.setstate(j.ID, state, err); err != nil {
+			log.Printf("job %s: can't save state: %v", j.ID, err)
+		}
+	})
+}
+
+// run does the transcription for j.
+func (s *server) run(j *queuedjob) error {
+	prof, err := pickprofile(s.profiles, j.Profile, j.Speakers)
+	if err != nil {
+		return err
+	}
+	return runjob(s.ctx, s.rec, &job{
+		uri:        j.URI,
+		outputfile: j.Output,
+		profile:    prof,
+		speakers:   j.Speakers,
+	})
+}
+
+// stop waits for the running and queued jobs to finish.
+func (s *server) stop() {
+	s.wp.StopWait()
+}
+
+// jobrequest is the body of a request to submit a job.
+type jobrequest struct {
+	URI      string `json:"uri"`
+	Profile  string `json:"profile"`
+	Speakers int    `json:"speakers"`
+}
+
+// ServeHTTP handles the job API:
+//
+//	POST /jobs              submit a jobrequest
+//	GET  /jobs              list the jobs
+//	GET  /jobs/<id>         get the status of a job
+//	GET  /jobs/<id>/result  download the result JSON
+//	GET  /jobs/<id>/text    download the result as text
+func (s *server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	switch {
+	case len(parts) == 1 && parts[0] == "jobs" && r.Method == http.MethodPost:
+		s.submit(w, r)
+	case len(parts) == 1 && parts[0] == "jobs" && r.Method == http.MethodGet:
+		replyjson(w, http.StatusOK, s.queue.list())
+	case len(parts) >= 2 && parts[0] == "jobs" && r.Method == http.MethodGet:
+		j := s.queue.get(parts[1])
+		if j == nil {
+			http.Error(w, fmt.Sprintf("no job %s", parts[1]), http.StatusNotFound)
+			return
+		}
+		switch {
+		case len(parts) == 2:
+			replyjson(w, http.StatusOK, j)
+		case len(parts) == 3 && parts[2] == "result":
+			s.result(w, r, j)
+		case len(parts) == 3 && parts[2] == "text":
+			s.text(w, j)
+		default:
+			http.NotFound(w, r)
+		}
+	case len(parts) >= 1 && parts[0] == "jobs":
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// submit queues the job described in the body of r.
+func (s *server) submit(w http.ResponseWriter, r *http.Request) {
+	var req jobrequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, fmt.Sprintf("bad job: %v", err), http.StatusBadRequest)
+		return
+	}
+	if _, _, err := splitgcsuri(req.URI); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.Speakers == 0 {
+		req.Speakers = *speakercount
+	}
+	if req.Speakers < 1 {
+		http.Error(w, "speakers must be at least 1", http.StatusBadRequest)
+		return
+	}
+	prof, err := pickprofile(s.profiles, req.Profile, req.Speakers)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	j, err := s.queue.add(req.URI, prof.Name, req.Speakers)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("can't queue job: %v", err), http.StatusInternalServerError)
+		return
+	}
+	log.Printf("job %s: queued %s with profile %s", j.ID, j.URI, j.Profile)
+	s.dispatch(j)
+	replyjson(w, http.StatusCreated, j)
+}
+
+// result sends the saved result of j.
+func (s *server) result(w http.ResponseWriter, r *http.Request, j *queuedjob) {
+	if j.State != jobdone {
+		http.Error(w, fmt.Sprintf("job %s is %s", j.ID, j.State), http.StatusConflict)
+		return
+	}
+	if strings.HasSuffix(j.Output, ".gz") {
+		w.Header().Set("Content-Type", "application/gzip")
+	} else {
+		w.Header().Set("Content-Type", "application/json")
+	}
+	http.ServeFile(w, r, j.Output)
+}
+
+// text sends the saved result of j as text.
+func (s *server) text(w http.ResponseWriter, j *queuedjob) {
+	if j.State != jobdone {
+		http.Error(w, fmt.Sprintf("job %s is %s", j.ID, j.State), http.StatusConflict)
+		return
+	}
+	resp, err := loadresult(j.Output)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("can't read result: %v", err), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	writetext(w, resp)
+}
+
+// replyjson sends v as the JSON body of a response with status code.
+func replyjson(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		log.Printf("can't write response: %v", err)
+	}
+}
+
+// loadresult reads a result saved by saveresult.
+func loadresult(fn string) (*speechpb.LongRunningRecognizeResponse, error) {
+	fd, err := os.Open(fn)
+	if err != nil {
+		return nil, err
+	}
+	defer fd.Close()
+	return decoderesult(fd, fn)
+}
+
+// decoderesult decodes the result named fn from r, decompressing it if
+// fn ends in .gz.
+func decoderesult(r io.Reader, fn string) (*speechpb.LongRunningRecognizeResponse, error) {
+	if strings.HasSuffix(fn, ".gz") {
+		zr, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", fn, err)
+		}
+		r = zr
+	}
+	var resp speechpb.LongRunningRecognizeResponse
+	if err := jsonpb.Unmarshal(r, &resp); err != nil {
+		return nil, fmt.Errorf("%s: %v", fn, err)
+	}
+	return &resp, nil
+}
+
+// writetext writes a plain dump of the transcript in resp to w, one
+// paragraph per speaker turn if the speakers were recognized and per
+// result if not. Speakers keep the API's tags: it doesn't label channels
+// or apply speaker names as prettyprint does.
+func writetext(w io.Writer, resp *speechpb.LongRunningRecognizeResponse) error {
+	// With diarization, the last result has all of the words.
+	var words []*speechpb.WordInfo
+	if n := len(resp.Results); n > 0 && len(resp.Results[n-1].Alternatives) > 0 {
+		words = resp.Results[n-1].Alternatives[0].Words
+	}
+	if len(words) == 0 || words[0].SpeakerTag == 0 {
+		for _, r := range resp.Results {
+			if len(r.Alternatives) == 0 {
+				continue
+			}
+			if _, err := fmt.Fprintf(w, "%s\n\n", strings.TrimSpace(r.Alternatives[0].Transcript)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	for i := 0; i < len(words); {
+		k := i
+		turn := make([]string, 0)
+		for ; k < len(words) && words[k].SpeakerTag == words[i].SpeakerTag; k++ {
+			turn = append(turn, words[k].Word)
+		}
+		start := words[i].StartTime.GetSeconds()
+		if _, err := fmt.Fprintf(w, "SPEAKER_%d %d:%02d:%02d\n%s\n\n", words[i].SpeakerTag, start/3600, start/60%60, start%60, strings.Join(turn, " ")); err != nil {
+			return err
+		}
+		i = k
+	}
+	return nil
+}
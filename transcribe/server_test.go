@@ -0,0 +1,176 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// getjson fetches url and decodes the JSON reply into v.
+func getjson(t *testing.T, url string, v interface{}) {
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET %s: status %s", url, resp.Status)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		t.Fatalf("GET %s: %v", url, err)
+	}
+}
+
+// waitjob polls the server until the job with id has finished.
+func waitjob(t *testing.T, url, id string) *queuedjob {
+	for i := 0; i < 500; i++ {
+		var j queuedjob
+		getjson(t, url+"/jobs/"+id, &j)
+		if j.State == jobdone || j.State == jobfailed {
+			return &j
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("job %s didn't finish", id)
+	return nil
+}
+
+func TestServer(t *testing.T) {
+	defer intempdir(t)()
+
+	f := newFakespeech()
+	f.scripts["gs://audioscratch/clip.wav"] = []fakestep{{progress: 50}, {resp: cannedresp}}
+	f.scripts["gs://audioscratch/bad.wav"] = []fakestep{{failure: status.New(codes.InvalidArgument, "bad audio")}}
+	rec, shutdown := newFakeRecognizer(t, f)
+	defer shutdown()
+
+	queue, err := openqueue("queue")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := newserver(context.Background(), rec, builtinprofiles, queue, 2)
+	defer s.stop()
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+
+	submit := func(body string) *http.Response {
+		resp, err := http.Post(srv.URL+"/jobs", "application/json", strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+
+	for _, body := range []string{`{"uri": "/etc/passwd"}`, `{"uri": "gs://audioscratch/clip.wav", "profile": "nosuch"}`, `not json`} {
+		if resp := submit(body); resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("submitting %s: got status %s", body, resp.Status)
+		}
+	}
+
+	resp := submit(`{"uri": "gs://audioscratch/clip.wav", "profile": "diarize", "speakers": 2}`)
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("submitting a job: status %s", resp.Status)
+	}
+	var good queuedjob
+	if err := json.NewDecoder(resp.Body).Decode(&good); err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	var bad queuedjob
+	resp = submit(`{"uri": "gs://audioscratch/bad.wav"}`)
+	if err := json.NewDecoder(resp.Body).Decode(&bad); err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if j := waitjob(t, srv.URL, good.ID); j.State != jobdone {
+		t.Errorf("job %s is %s: %s", j.ID, j.State, j.Error)
+	}
+	if j := waitjob(t, srv.URL, bad.ID); j.State != jobfailed || !strings.Contains(j.Error, "bad audio") {
+		t.Errorf("job %s is %s: %s", j.ID, j.State, j.Error)
+	}
+	if got, want := f.submitted[0].Config.DiarizationSpeakerCount, int32(2); got != want {
+		t.Errorf("submitted %d speakers, want %d", got, want)
+	}
+
+	var jobs []*queuedjob
+	getjson(t, srv.URL+"/jobs", &jobs)
+	if len(jobs) != 2 || jobs[0].ID != good.ID || jobs[1].ID != bad.ID {
+		t.Errorf("listed %v, want jobs %s and %s", jobs, good.ID, bad.ID)
+	}
+
+	resp, err = http.Get(srv.URL + "/jobs/" + good.ID + "/result")
+	if err != nil {
+		t.Fatal(err)
+	}
+	buffy, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if !strings.Contains(string(buffy), `"transcript":"hello there"`) {
+		t.Errorf("result is %s", buffy)
+	}
+
+	resp, err = http.Get(srv.URL + "/jobs/" + good.ID + "/text")
+	if err != nil {
+		t.Fatal(err)
+	}
+	buffy, _ = ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if got, want := string(buffy), "SPEAKER_1 0:00:01\nhello\n\nSPEAKER_2 0:00:02\nthere\n\n"; got != want {
+		t.Errorf("text is %q, want %q", got, want)
+	}
+
+	for _, path := range []string{"/jobs/nosuch", "/jobs/" + bad.ID + "/result"} {
+		resp, err := http.Get(srv.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode == http.StatusOK {
+			t.Errorf("GET %s succeeded", path)
+		}
+	}
+}
+
+func TestServerResumes(t *testing.T) {
+	defer intempdir(t)()
+
+	f := newFakespeech()
+	f.scripts["gs://audioscratch/clip.wav"] = []fakestep{{resp: cannedresp}}
+	rec, shutdown := newFakeRecognizer(t, f)
+	defer shutdown()
+
+	// A job queued by a server that then stopped.
+	queue, err := openqueue("queue")
+	if err != nil {
+		t.Fatal(err)
+	}
+	j, err := queue.add("gs://audioscratch/clip.wav", "default", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	queue, err = openqueue("queue")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := queue.get(j.ID); got == nil || got.State != jobqueued {
+		t.Fatalf("reopened queue has %v", got)
+	}
+	s := newserver(context.Background(), rec, builtinprofiles, queue, 1)
+	s.stop()
+
+	if got := queue.get(j.ID); got.State != jobdone {
+		t.Errorf("resumed job is %s: %s", got.State, got.Error)
+	}
+	if got, want := readresult(t, j.Output).Results[0].Alternatives[0].Transcript, "hello there"; got != want {
+		t.Errorf("saved transcript %q, want %q", got, want)
+	}
+}
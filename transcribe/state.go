@@ -0,0 +1,128 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// pendingop records a submitted long running recognition operation so
+// that a restarted transcribe can reattach to it.
+type pendingop struct {
+	Name      string    // The operation name returned by the API.
+	URI       string    // The audio being transcribed.
+	Output    string    // Where the result will be written.
+	Submitted time.Time // When the operation was submitted.
+}
+
+// opstate is the set of pending operations, keyed by output file. It is
+// saved to a local file each time it changes.
+type opstate struct {
+	mu   sync.Mutex
+	path string
+	ops  map[string]*pendingop
+}
+
+// pending holds the operations in flight. It is nil if the operations
+// are not being saved.
+var pending *opstate
+
+// loadstate reads the pending operations from the state file fn. A
+// missing state file is the same as one with no pending operations.
+func loadstate(fn string) (*opstate, error) {
+	st := &opstate{
+		path: fn,
+		ops:  make(map[string]*pendingop),
+	}
+
+	buffy, err := ioutil.ReadFile(fn)
+	if os.IsNotExist(err) {
+		return st, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	ops := make([]*pendingop, 0)
+	if err := json.Unmarshal(buffy, &ops); err != nil {
+		return nil, err
+	}
+	for _, op := range ops {
+		st.ops[op.Output] = op
+	}
+	return st, nil
+}
+
+// lookup returns the pending operation that will write to output or nil
+// if there isn't one.
+func (st *opstate) lookup(output string) *pendingop {
+	if st == nil {
+		return nil
+	}
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	return st.ops[output]
+}
+
+// add records op as pending and saves the state.
+func (st *opstate) add(op *pendingop) error {
+	if st == nil {
+		return nil
+	}
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.ops[op.Output] = op
+	return st.save()
+}
+
+// remove forgets the operation writing to output and saves the state.
+func (st *opstate) remove(output string) error {
+	if st == nil {
+		return nil
+	}
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if _, ok := st.ops[output]; !ok {
+		return nil
+	}
+	delete(st.ops, output)
+	return st.save()
+}
+
+// save writes the state file. It writes a temporary file and renames it
+// so that a crash mid-write doesn't lose the pending operations. Must be
+// called with mu held.
+func (st *opstate) save() error {
+	ops := make([]*pendingop, 0, len(st.ops))
+	for _, op := range st.ops {
+		ops = append(ops, op)
+	}
+	buffy, err := json.MarshalIndent(ops, "", "\t")
+	if err != nil {
+		return err
+	}
+
+	return writeatomic(st.path, buffy)
+}
+
+// writeatomic replaces the file fn with buffy so that readers see either
+// the old or the new contents even if transcribe dies part way through.
+func writeatomic(fn string, buffy []byte) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(fn), filepath.Base(fn))
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(buffy); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), fn)
+}
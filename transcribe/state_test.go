@@ -0,0 +1,69 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestOpstateRoundTrip(t *testing.T) {
+	dir, err := ioutil.TempDir("", "transcribe")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	fn := filepath.Join(dir, "state.json")
+
+	st, err := loadstate(fn)
+	if err != nil {
+		t.Fatalf("missing state file should be empty: %v", err)
+	}
+	if p := st.lookup("clip.json"); p != nil {
+		t.Errorf("empty state has %v", p)
+	}
+
+	submitted := time.Date(2019, 6, 14, 10, 0, 0, 0, time.UTC)
+	for _, n := range []string{"clip", "other"} {
+		if err := st.add(&pendingop{
+			Name:      "op-" + n,
+			URI:       "gs://audioscratch/" + n + ".wav",
+			Output:    n + ".json",
+			Submitted: submitted,
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := st.remove("other.json"); err != nil {
+		t.Fatal(err)
+	}
+
+	restarted, err := loadstate(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := restarted.lookup("clip.json")
+	if p == nil {
+		t.Fatal("clip.json not pending after reload")
+	}
+	if p.Name != "op-clip" || p.URI != "gs://audioscratch/clip.wav" || !p.Submitted.Equal(submitted) {
+		t.Errorf("reloaded op is %+v", p)
+	}
+	if p := restarted.lookup("other.json"); p != nil {
+		t.Errorf("removed op is still pending: %v", p)
+	}
+}
+
+func TestNilOpstate(t *testing.T) {
+	var st *opstate
+	if err := st.add(&pendingop{Output: "clip.json"}); err != nil {
+		t.Error(err)
+	}
+	if p := st.lookup("clip.json"); p != nil {
+		t.Errorf("nil state has %v", p)
+	}
+	if err := st.remove("clip.json"); err != nil {
+		t.Error(err)
+	}
+}
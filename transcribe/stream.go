@@ -0,0 +1,275 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes"
+	"github.com/golang/protobuf/ptypes/duration"
+	"golang.org/x/net/context"
+	speechpb "google.golang.org/genproto/googleapis/cloud/speech/v1p1beta1"
+)
+
+// streamlimit is how much audio to send on one stream. The API ends
+// streams after about five minutes so transcribe reconnects before then.
+var streamlimit = 290 * time.Second
+
+// streampace is how fast to send the audio as a fraction of real time.
+// The API rejects audio sent much faster than real time.
+var streampace = 1.0
+
+// maxstreamchunk is the most audio to send in one streaming request.
+const maxstreamchunk = 16000
+
+// streamoutputname is the name of the file that shows the progress of
+// a streaming transcription to outputfile.
+func streamoutputname(outputfile string) string {
+	return resultbase(outputfile) + ".stream.txt"
+}
+
+// sendStreaming transcribes the local WAV file localpath with streaming
+// recognition using config. Interim and final results are written to the progress
+// file as they arrive. The result has the same form as the result of a
+// long running recognition: with diarization, the words of every stream
+// are repeated with their speakers in the last result.
+func sendStreaming(ctx context.Context, rec recognizer, config *speechpb.RecognitionConfig, localpath, outputfile string) (*speechpb.LongRunningRecognizeResponse, error) {
+	info, err := localaudioinfo(localpath)
+	if err != nil {
+		return nil, err
+	}
+	if info.encoding != speechpb.RecognitionConfig_LINEAR16 {
+		return nil, fmt.Errorf("%s: can only stream 16 bit PCM WAV files", localpath)
+	}
+
+	fd, err := os.Open(localpath)
+	if err != nil {
+		return nil, err
+	}
+	defer fd.Close()
+
+	// Skip the header and stream only the samples.
+	blockalign := 2 * info.channels
+	byterate := int64(info.samplerate * blockalign)
+	datasize := info.datasize
+	if _, err := fd.Seek(info.dataoffset, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	progressfile := streamoutputname(outputfile)
+	pfd, err := os.Create(progressfile)
+	if err != nil {
+		return nil, err
+	}
+	defer pfd.Close()
+	progress := bufio.NewWriter(pfd)
+
+	config = proto.Clone(config).(*speechpb.RecognitionConfig)
+	config.Encoding = info.encoding
+	config.SampleRateHertz = int32(info.samplerate)
+	config.AudioChannelCount = int32(info.channels)
+
+	chunksize := maxstreamchunk / blockalign * blockalign
+	perstream := int64(streamlimit) * byterate / int64(time.Second)
+	resp := &speechpb.LongRunningRecognizeResponse{}
+	var speakerwords []*speechpb.WordInfo
+	nexttag := int32(1)
+	for sent := int64(0); sent < datasize; sent += perstream {
+		offset := time.Duration(sent * int64(time.Second) / byterate)
+		segment := io.LimitReader(fd, perstream)
+		log.Printf("%s: streaming from %v", localpath, offset)
+
+		results, err := streamsegment(ctx, rec, config, segment, chunksize, byterate, offset, progress)
+		if err != nil {
+			return nil, err
+		}
+		if words := diarizedwords(results); words != nil {
+			results = results[:len(results)-1]
+			nexttag = relabelstream(words, nexttag)
+			speakerwords = append(speakerwords, words...)
+		}
+		resp.Results = append(resp.Results, results...)
+	}
+	if speakerwords != nil {
+		if nexttag-1 > config.DiarizationSpeakerCount && config.DiarizationSpeakerCount > 0 {
+			log.Printf("%s: speakers can't be matched between streams, found %d speakers for %d", localpath, nexttag-1, config.DiarizationSpeakerCount)
+		}
+		resp.Results = append(resp.Results, &speechpb.SpeechRecognitionResult{
+			Alternatives: []*speechpb.SpeechRecognitionAlternative{{Words: speakerwords}},
+		})
+	}
+	return resp, progress.Flush()
+}
+
+// diarizedwords returns the words of the last of results if it repeats
+// the words of its stream with their speakers, as it does when the
+// speakers are recognized.
+func diarizedwords(results []*speechpb.SpeechRecognitionResult) []*speechpb.WordInfo {
+	if len(results) == 0 || len(results[len(results)-1].Alternatives) == 0 {
+		return nil
+	}
+	words := results[len(results)-1].Alternatives[0].Words
+	if len(words) == 0 || words[0].SpeakerTag == 0 {
+		return nil
+	}
+	return words
+}
+
+// relabelstream gives the speakers of the words of one stream new tags
+// from next on and returns the tag after them. Each stream recognizes
+// its speakers on its own and streams share no audio to match them by,
+// so a speaker who talks in several streams has a tag in each.
+func relabelstream(words []*speechpb.WordInfo, next int32) int32 {
+	tags := make(map[int32]int32)
+	for _, wi := range words {
+		tag, ok := tags[wi.SpeakerTag]
+		if !ok {
+			tag = next
+			next++
+			tags[wi.SpeakerTag] = tag
+		}
+		wi.SpeakerTag = tag
+	}
+	return next
+}
+
+// streamsegment sends audio from segment on a new stream and collects
+// the final results. offset is where segment starts in the whole file.
+func streamsegment(ctx context.Context, rec recognizer, config *speechpb.RecognitionConfig, segment io.Reader, chunksize int, byterate int64, offset time.Duration, progress *bufio.Writer) ([]*speechpb.SpeechRecognitionResult, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	stream, err := rec.Stream(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := stream.Send(&speechpb.StreamingRecognizeRequest{
+		StreamingRequest: &speechpb.StreamingRecognizeRequest_StreamingConfig{
+			StreamingConfig: &speechpb.StreamingRecognitionConfig{
+				Config:         config,
+				InterimResults: true,
+			},
+		},
+	}); err != nil {
+		return nil, err
+	}
+
+	senderr := make(chan error, 1)
+	go func() {
+		senderr <- sendaudio(stream, segment, chunksize, byterate)
+	}()
+
+	results := make([]*speechpb.SpeechRecognitionResult, 0)
+	for {
+		sresp, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if sresp.Error != nil {
+			return nil, fmt.Errorf("streaming recognition failed: %s", sresp.Error.Message)
+		}
+
+		for _, sr := range sresp.Results {
+			if len(sr.Alternatives) == 0 {
+				continue
+			}
+			if err := writeprogress(progress, sr, offset); err != nil {
+				return nil, err
+			}
+			if sr.IsFinal {
+				results = append(results, finalresult(sr, offset))
+			}
+		}
+	}
+	if err := <-senderr; err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// sendaudio sends all of audio on stream in chunks of chunksize bytes,
+// pacing it by streampace.
+func sendaudio(stream speechpb.Speech_StreamingRecognizeClient, audio io.Reader, chunksize int, byterate int64) error {
+	start := time.Now()
+	sent := int64(0)
+	buffy := make([]byte, chunksize)
+	for {
+		n, err := io.ReadFull(audio, buffy)
+		if n > 0 {
+			if err := stream.Send(&speechpb.StreamingRecognizeRequest{
+				StreamingRequest: &speechpb.StreamingRecognizeRequest_AudioContent{
+					AudioContent: append([]byte(nil), buffy[:n]...),
+				},
+			}); err != nil {
+				return err
+			}
+			sent += int64(n)
+			if streampace > 0 {
+				due := time.Duration(float64(sent*int64(time.Second)/byterate) / streampace)
+				time.Sleep(due - time.Since(start))
+			}
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return stream.CloseSend()
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// writeprogress writes an interim or final result to the progress file
+// and flushes it so that it can be watched.
+func writeprogress(progress *bufio.Writer, sr *speechpb.StreamingRecognitionResult, offset time.Duration) error {
+	kind := "interim"
+	if sr.IsFinal {
+		kind = "final"
+	}
+	end := offset
+	if d, err := ptypes.Duration(sr.ResultEndTime); err == nil {
+		end += d
+	}
+	if _, err := fmt.Fprintf(progress, "%v %s: %s\n", end, kind, strings.TrimSpace(sr.Alternatives[0].Transcript)); err != nil {
+		return err
+	}
+	return progress.Flush()
+}
+
+// finalresult converts a final streaming result into the same form as
+// the results of a long running recognition. The word times are moved
+// by offset to be relative to the start of the whole file.
+func finalresult(sr *speechpb.StreamingRecognitionResult, offset time.Duration) *speechpb.SpeechRecognitionResult {
+	result := &speechpb.SpeechRecognitionResult{
+		ChannelTag:   sr.ChannelTag,
+		LanguageCode: sr.LanguageCode,
+	}
+	for _, alt := range sr.Alternatives {
+		nalt := proto.Clone(alt).(*speechpb.SpeechRecognitionAlternative)
+		for _, wi := range nalt.Words {
+			wi.StartTime = shiftduration(wi.StartTime, offset)
+			wi.EndTime = shiftduration(wi.EndTime, offset)
+		}
+		result.Alternatives = append(result.Alternatives, nalt)
+	}
+	return result
+}
+
+// shiftduration returns d moved later by offset.
+func shiftduration(d *duration.Duration, offset time.Duration) *duration.Duration {
+	if offset == 0 || d == nil {
+		return d
+	}
+	gd, err := ptypes.Duration(d)
+	if err != nil {
+		return d
+	}
+	return ptypes.DurationProto(gd + offset)
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/ptypes"
+	"golang.org/x/net/context"
+)
+
+func TestDotranscribeStreaming(t *testing.T) {
+	defer intempdir(t)()
+
+	oldlimit, oldpace, oldstreaming := streamlimit, streampace, *streaming
+	streamlimit, streampace, *streaming = 2*time.Second, 0, true
+	defer func() {
+		streamlimit, streampace, *streaming = oldlimit, oldpace, oldstreaming
+	}()
+
+	f := newFakespeech()
+	rec, shutdown := newFakeRecognizer(t, f)
+	defer shutdown()
+
+	if err := ioutil.WriteFile("clip.wav", makewav(16000, 1, 5*time.Second), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := dotranscribe(context.Background(), rec, "clip.wav"); err != nil {
+		t.Fatalf("dotranscribe failed: %v", err)
+	}
+
+	// 5 seconds of audio in 2 second streams.
+	if got, want := f.streamed, []int{64000, 64000, 32000}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("streamed %v bytes, want %v", got, want)
+	}
+
+	resp := readresult(t, "clip-en-US.json")
+	if got, want := len(resp.Results), 3; got != want {
+		t.Fatalf("saved %d results, want %d", got, want)
+	}
+	for i, r := range resp.Results {
+		start, err := ptypes.Duration(r.Alternatives[0].Words[0].StartTime)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := time.Second + time.Duration(i)*2*time.Second; start != want {
+			t.Errorf("result %d word starts at %v, want %v", i, start, want)
+		}
+	}
+
+	progress, err := ioutil.ReadFile("clip-en-US.stream.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"interim: stream 0 chunk 0", "6s final: stream 2"} {
+		if !strings.Contains(string(progress), want) {
+			t.Errorf("progress file is missing %q:\n%s", want, progress)
+		}
+	}
+}
+
+func TestDotranscribeStreamingDiarized(t *testing.T) {
+	defer intempdir(t)()
+
+	oldlimit, oldpace, oldstreaming, oldspeakers := streamlimit, streampace, *streaming, *speakercount
+	streamlimit, streampace, *streaming, *speakercount = 2*time.Second, 0, true, 2
+	defer func() {
+		streamlimit, streampace, *streaming, *speakercount = oldlimit, oldpace, oldstreaming, oldspeakers
+	}()
+
+	f := newFakespeech()
+	rec, shutdown := newFakeRecognizer(t, f)
+	defer shutdown()
+
+	if err := ioutil.WriteFile("clip.wav", makewav(16000, 1, 5*time.Second), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := dotranscribe(context.Background(), rec, "clip.wav"); err != nil {
+		t.Fatalf("dotranscribe failed: %v", err)
+	}
+
+	// Each stream's words with speakers are merged into the last result.
+	resp := readresult(t, "clip-en-US.json")
+	if got, want := len(resp.Results), 4; got != want {
+		t.Fatalf("saved %d results, want %d", got, want)
+	}
+	words := resp.Results[3].Alternatives[0].Words
+	if got, want := len(words), 3; got != want {
+		t.Fatalf("last result has %d words, want %d", got, want)
+	}
+	for i, wi := range words {
+		start, err := ptypes.Duration(wi.StartTime)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := time.Second + time.Duration(i)*2*time.Second; start != want {
+			t.Errorf("word %d starts at %v, want %v", i, start, want)
+		}
+		// Speakers can't be matched between streams.
+		if got, want := wi.SpeakerTag, int32(i+1); got != want {
+			t.Errorf("word %d has speaker %d, want %d", i, got, want)
+		}
+	}
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"bytes"
+	"crypto/md5"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"cloud.google.com/go/storage"
+	"golang.org/x/net/context"
+	"google.golang.org/api/option"
+)
+
+// uploadchunksize is the size of each piece of a resumable upload.
+// Smaller files are uploaded in a single request.
+var uploadchunksize = 8 << 20
+
+// audiotypes maps the extensions of the local audio files that
+// transcribe will upload to their content types.
+var audiotypes = map[string]string{
+	".wav":  "audio/wav",
+	".flac": "audio/flac",
+}
+
+var (
+	gcsmu sync.Mutex
+	gcs   *storage.Client
+)
+
+// storageclient returns the GCS client shared by all jobs, making it on
+// first use.
+func storageclient(ctx context.Context) (*storage.Client, error) {
+	gcsmu.Lock()
+	defer gcsmu.Unlock()
+	if gcs != nil {
+		return gcs, nil
+	}
+
+	var opts []option.ClientOption
+	if *storageendpoint != "" {
+		endpoint, err := url.Parse(*storageendpoint)
+		if err != nil {
+			return nil, fmt.Errorf("bad -storageendpoint %q: %v", *storageendpoint, err)
+		}
+		// The storage library sends some requests to a fixed host so
+		// rewrite every request rather than using option.WithEndpoint.
+		opts = append(opts, option.WithHTTPClient(&http.Client{
+			Transport: &endpointtransport{endpoint: endpoint, base: http.DefaultTransport},
+		}))
+	}
+
+	client, err := storage.NewClient(ctx, opts...)
+	if err != nil {
+		return nil, err
+	}
+	gcs = client
+	return gcs, nil
+}
+
+// endpointtransport sends every request to endpoint instead of the host
+// in its URL.
+type endpointtransport struct {
+	endpoint *url.URL
+	base     http.RoundTripper
+}
+
+func (e *endpointtransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	nreq := new(http.Request)
+	*nreq = *req
+	nurl := *req.URL
+	nurl.Scheme = e.endpoint.Scheme
+	nurl.Host = e.endpoint.Host
+	nreq.URL = &nurl
+	nreq.Host = ""
+	return e.base.RoundTrip(nreq)
+}
+
+// islocalaudio returns true if name is an audio file on the local
+// filesystem that can be uploaded.
+func islocalaudio(name string) bool {
+	if _, ok := audiotypes[strings.ToLower(filepath.Ext(name))]; !ok {
+		return false
+	}
+	fi, err := os.Stat(name)
+	return err == nil && fi.Mode().IsRegular()
+}
+
+// filemd5 computes the MD5 checksum of the file at fn.
+func filemd5(fn string) ([]byte, error) {
+	fd, err := os.Open(fn)
+	if err != nil {
+		return nil, err
+	}
+	defer fd.Close()
+
+	h := md5.New()
+	if _, err := io.Copy(h, fd); err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
+
+// uploadaudio copies the local audio file localpath to the object at
+// gcsURI. The upload is skipped if an object with the same MD5 checksum
+// is already there.
+func uploadaudio(ctx context.Context, localpath, gcsURI string) error {
+	bucket, objname, err := splitgcsuri(gcsURI)
+	if err != nil {
+		return err
+	}
+	client, err := storageclient(ctx)
+	if err != nil {
+		return err
+	}
+	sum, err := filemd5(localpath)
+	if err != nil {
+		return err
+	}
+
+	obj := client.Bucket(bucket).Object(objname)
+	attrs, err := obj.Attrs(ctx)
+	switch {
+	case err == nil && bytes.Equal(attrs.MD5, sum):
+		log.Printf("%s already uploaded to %s. skipping upload...", localpath, gcsURI)
+		return nil
+	case err == nil:
+		log.Printf("%s differs from %s. replacing it...", gcsURI, localpath)
+	case err != storage.ErrObjectNotExist:
+		return err
+	}
+
+	fd, err := os.Open(localpath)
+	if err != nil {
+		return err
+	}
+	defer fd.Close()
+
+	// The server rejects the upload if the data it receives doesn't match
+	// MD5.
+	w := obj.NewWriter(ctx)
+	w.ChunkSize = uploadchunksize
+	w.ContentType = audiotypes[strings.ToLower(filepath.Ext(localpath))]
+	w.MD5 = sum
+	if _, err := io.Copy(w, fd); err != nil {
+		w.Close()
+		return fmt.Errorf("can't upload %s to %s: %v", localpath, gcsURI, err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("can't upload %s to %s: %v", localpath, gcsURI, err)
+	}
+	if !bytes.Equal(w.Attrs().MD5, sum) {
+		return fmt.Errorf("uploaded %s to %s but the checksums differ", localpath, gcsURI)
+	}
+	log.Printf("uploaded %s to %s", localpath, gcsURI)
+	return nil
+}
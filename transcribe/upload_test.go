@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"reflect"
+	"testing"
+
+	"golang.org/x/net/context"
+)
+
+func TestUploadaudio(t *testing.T) {
+	defer intempdir(t)()
+	f, shutdown := usefakegcs(t)
+	defer shutdown()
+
+	audio := bytes.Repeat([]byte("RIFF"), 256)
+	if err := ioutil.WriteFile("clip.wav", audio, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	if err := uploadaudio(ctx, "clip.wav", "gs://audioscratch/clip.wav"); err != nil {
+		t.Fatalf("upload failed: %v", err)
+	}
+	if got := f.get("audioscratch", "clip.wav"); !bytes.Equal(got, audio) {
+		t.Errorf("uploaded %d bytes, want %d", len(got), len(audio))
+	}
+
+	// An identical object is not uploaded again.
+	if err := uploadaudio(ctx, "clip.wav", "gs://audioscratch/clip.wav"); err != nil {
+		t.Fatalf("second upload failed: %v", err)
+	}
+	if got, want := f.uploads, 1; got != want {
+		t.Errorf("uploaded %d times, want %d", got, want)
+	}
+
+	// A changed one is.
+	audio = append(audio, "more"...)
+	if err := ioutil.WriteFile("clip.wav", audio, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := uploadaudio(ctx, "clip.wav", "gs://audioscratch/clip.wav"); err != nil {
+		t.Fatalf("upload of changed file failed: %v", err)
+	}
+	if got, want := f.uploads, 2; got != want {
+		t.Errorf("uploaded %d times, want %d", got, want)
+	}
+	if got := f.get("audioscratch", "clip.wav"); !bytes.Equal(got, audio) {
+		t.Errorf("uploaded %d bytes, want %d", len(got), len(audio))
+	}
+}
+
+func TestUploadaudioResumable(t *testing.T) {
+	defer intempdir(t)()
+	f, shutdown := usefakegcs(t)
+	defer shutdown()
+
+	oldchunksize := uploadchunksize
+	uploadchunksize = 256 << 10
+	defer func() { uploadchunksize = oldchunksize }()
+
+	audio := bytes.Repeat([]byte("0123456789abcdef"), 40000)
+	if err := ioutil.WriteFile("long.flac", audio, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := uploadaudio(context.Background(), "long.flac", "gs://audioscratch/kids/long.flac"); err != nil {
+		t.Fatalf("upload failed: %v", err)
+	}
+	if got, want := f.resumable, 1; got != want {
+		t.Errorf("made %d resumable uploads, want %d", got, want)
+	}
+	if got := f.get("audioscratch", "kids/long.flac"); !bytes.Equal(got, audio) {
+		t.Errorf("uploaded %d bytes, want %d", len(got), len(audio))
+	}
+}
+
+func TestDotranscribeLocal(t *testing.T) {
+	defer intempdir(t)()
+	g, shutdown := usefakegcs(t)
+	defer shutdown()
+
+	f := newFakespeech()
+	f.scripts["gs://audioscratch/clip.wav"] = []fakestep{{resp: cannedresp}}
+	rec, shutdownspeech := newFakeRecognizer(t, f)
+	defer shutdownspeech()
+
+	if err := ioutil.WriteFile("clip.wav", []byte("RIFF audio"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := dotranscribe(context.Background(), rec, "clip.wav"); err != nil {
+		t.Fatalf("dotranscribe failed: %v", err)
+	}
+	if g.get("audioscratch", "clip.wav") == nil {
+		t.Error("local audio was not uploaded")
+	}
+	if got, want := readresult(t, "clip-en-US.json").Results[0].Alternatives[0].Transcript, "hello there"; got != want {
+		t.Errorf("saved transcript %q, want %q", got, want)
+	}
+}
+
+func TestGlobobjects(t *testing.T) {
+	f, shutdown := usefakegcs(t)
+	defer shutdown()
+
+	for _, n := range []string{"kids/clip-1.wav", "kids/clip-2-<0>.wav", "kids/notes.txt", "other/clip-3.wav"} {
+		f.put("audioscratch", n, []byte("RIFF"))
+	}
+
+	got, err := globobjects(context.Background(), "gs://audioscratch/kids", "*.wav")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"clip-1.wav", "clip-2-<0>.wav"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}